@@ -0,0 +1,198 @@
+// Package bridge mirrors gateway resources to MQTT topics.
+//
+// Every configured URI is observed and each notification is published to its state topic.
+// Messages published to the command topics of a URI are sent to the gateway as PUT or POST requests.
+package bridge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	gocoap "github.com/moroen/gocoap/v5"
+	"github.com/plgd-dev/go-coap/v2/message"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorStarted is returned by Start when the Bridge is already started
+var ErrorStarted = errors.New("Bridge Error: Already started")
+
+// Default topic templates. {host} is replaced with the gateway host, {uri} with the resource path
+// without leading slash and {method} with put or post
+const (
+	DefaultStateTopic   = "gocoap/{host}/{uri}"
+	DefaultCommandTopic = "gocoap/{host}/{uri}/{method}"
+)
+
+// Bridge mirrors Uris on Connection to Broker. StateTopic and CommandTopic default to DefaultStateTopic
+// and DefaultCommandTopic, QoS and Retain apply to state messages and command subscriptions.
+//
+// Observations end with the DTLS session, so Start registers a connect hook on the Connection to observe
+// the Uris again after every reconnect
+type Bridge struct {
+	mu           sync.Mutex
+	Connection   *gocoap.CoapDTLSConnection
+	Broker       Broker
+	Uris         []string
+	StateTopic   string
+	CommandTopic string
+	QoS          byte
+	Retain       bool
+	Timeout      time.Duration
+	observations []*gocoap.CoapDTLSObservation
+	subscribed   []string
+	started      bool
+	hooked       bool
+}
+
+// Start observes all Uris and subscribes to their command topics. The Connection must be connected.
+// Starting a started Bridge returns ErrorStarted, Stop it first
+func (b *Bridge) Start(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.started {
+		return ErrorStarted
+	}
+
+	if b.Timeout == 0 {
+		b.Timeout = 5 * time.Second
+	}
+
+	if err := b.observe(ctx); err != nil {
+		b.stop(ctx)
+		return err
+	}
+
+	for _, uri := range b.Uris {
+		uri := uri
+		for _, method := range []gocoap.RequestMethod{gocoap.PUT, gocoap.POST} {
+			method := method
+			commandTopic := b.topic(b.CommandTopic, DefaultCommandTopic, uri, strings.ToLower(method.String()))
+
+			if err := b.Broker.Subscribe(commandTopic, b.QoS, func(topic string, payload []byte) {
+				b.command(method, uri, payload)
+			}); err != nil {
+				b.stop(ctx)
+				return err
+			}
+			b.subscribed = append(b.subscribed, commandTopic)
+		}
+	}
+
+	b.started = true
+	if !b.hooked {
+		b.hooked = true
+		b.Connection.AddOnConnect(b.reconnected)
+	}
+	return nil
+}
+
+// observe observes all Uris and publishes their notifications to the state topics, b.mu must be held
+func (b *Bridge) observe(ctx context.Context) error {
+	for _, uri := range b.Uris {
+		uri := uri
+		stateTopic := b.topic(b.StateTopic, DefaultStateTopic, uri, "")
+
+		obs, err := b.Connection.Observe(ctx, uri, func(m []byte, err error) {
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Uri":   uri,
+					"Error": err.Error(),
+				}).Debug("Bridge: Notification")
+				return
+			}
+
+			if err := b.Broker.Publish(stateTopic, b.QoS, b.Retain, m); err != nil {
+				log.WithFields(log.Fields{
+					"Topic": stateTopic,
+					"Error": err.Error(),
+				}).Error("Bridge: Publish")
+			}
+		})
+		if err != nil {
+			return err
+		}
+		b.observations = append(b.observations, obs)
+	}
+	return nil
+}
+
+// reconnected observes the Uris again on the new DTLS session, the observations of the old one ended
+// with it
+func (b *Bridge) reconnected() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.started {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	b.observations = nil
+	if err := b.observe(ctx); err != nil {
+		log.WithFields(log.Fields{
+			"Host":  b.Connection.Host,
+			"Error": err.Error(),
+		}).Error("Bridge: Observe after reconnect")
+	}
+}
+
+// Stop cancels all observations and unsubscribes from the command topics
+func (b *Bridge) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stop(ctx)
+}
+
+func (b *Bridge) stop(ctx context.Context) error {
+	var result error
+	b.started = false
+
+	for _, topic := range b.subscribed {
+		if err := b.Broker.Unsubscribe(topic); err != nil {
+			result = err
+		}
+	}
+	b.subscribed = nil
+
+	for _, obs := range b.observations {
+		if err := obs.Cancel(ctx); err != nil {
+			result = err
+		}
+	}
+	b.observations = nil
+
+	return result
+}
+
+func (b *Bridge) command(method gocoap.RequestMethod, uri string, payload []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+	defer cancel()
+
+	b.Connection.Do(ctx, method, uri, message.AppJSON, payload, func(response gocoap.CoapResponse, err error) {
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Method": method.String(),
+				"Uri":    uri,
+				"Error":  err.Error(),
+			}).Error("Bridge: Command")
+		}
+	})
+}
+
+func (b *Bridge) topic(template, fallback, uri, method string) string {
+	if template == "" {
+		template = fallback
+	}
+	return strings.NewReplacer(
+		"{host}", b.Connection.Host,
+		"{uri}", strings.Trim(uri, "/"),
+		"{method}", method,
+	).Replace(template)
+}
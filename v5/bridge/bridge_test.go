@@ -0,0 +1,211 @@
+package bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	gocoap "github.com/moroen/gocoap/v5"
+)
+
+// testGateway starts a loopback gateway with an observable lamp on port, a free port when it is 0
+func testGateway(t *testing.T, port int) (*gocoap.CoapServer, *gocoap.ObservableResource, chan string) {
+	t.Helper()
+
+	if port == 0 {
+		l, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port = l.LocalAddr().(*net.UDPAddr).Port
+		l.Close()
+	}
+
+	commands := make(chan string, 4)
+	s := &gocoap.CoapServer{Host: "127.0.0.1", Port: port, Ident: "test", Key: "secret"}
+	lamp := s.Observable("/15001/65537", []byte(`{"5850":0}`))
+	s.Handle("/15001/65537", gocoap.PUT, func(req gocoap.ServerRequest) ([]byte, error) {
+		commands <- string(req.Payload)
+		return nil, nil
+	})
+	go s.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s, lamp, commands
+}
+
+// testConnection connects to s and closes the connection at the end of the test
+func testConnection(t *testing.T, s *gocoap.CoapServer) *gocoap.CoapDTLSConnection {
+	t.Helper()
+
+	conn := &gocoap.CoapDTLSConnection{Host: s.Host, Port: s.Port, Ident: s.Ident, Key: s.Key}
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		conn.Close(ctx)
+	})
+	return conn
+}
+
+// waitRetained waits until the retained message of topic is want
+func waitRetained(t *testing.T, broker *MemoryBroker, topic string, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := broker.Retained(topic)
+		if string(got) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("retained %s: got %q, want %q", topic, got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	s, lamp, commands := testGateway(t, 0)
+	conn := testConnection(t, s)
+
+	broker := &MemoryBroker{}
+	b := &Bridge{Connection: conn, Broker: broker, Uris: []string{"15001/65537"}, Retain: true}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop(context.Background())
+
+	state := "gocoap/127.0.0.1/15001/65537"
+	waitRetained(t, broker, state, `{"5850":0}`)
+
+	lamp.Set([]byte(`{"5850":1}`))
+	waitRetained(t, broker, state, `{"5850":1}`)
+
+	broker.Publish("gocoap/127.0.0.1/15001/65537/put", 0, false, []byte(`{"3311":[{"5850":0}]}`))
+	select {
+	case got := <-commands:
+		if got != `{"3311":[{"5850":0}]}` {
+			t.Errorf("command: got %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("command not sent")
+	}
+}
+
+func TestBridgeReconnect(t *testing.T) {
+	s, _, _ := testGateway(t, 0)
+	conn := testConnection(t, s)
+
+	connected := 0
+	conn.OnConnect = func() { connected++ }
+
+	broker := &MemoryBroker{}
+	b := &Bridge{Connection: conn, Broker: broker, Uris: []string{"15001/65537"}, Retain: true}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop(context.Background())
+
+	state := "gocoap/127.0.0.1/15001/65537"
+	waitRetained(t, broker, state, `{"5850":0}`)
+
+	// The gateway restarts, the observations of the old session are gone
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.Shutdown(ctx)
+	conn.Disconnect()
+
+	_, lamp, _ := testGateway(t, s.Port)
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if connected != 1 {
+		t.Errorf("OnConnect of the connection called %d times, want 1", connected)
+	}
+	if lamp.Observers() != 1 {
+		t.Fatalf("got %d observers after reconnect, want 1", lamp.Observers())
+	}
+
+	lamp.Set([]byte(`{"5850":1}`))
+	waitRetained(t, broker, state, `{"5850":1}`)
+}
+
+func TestBridgeStartTwice(t *testing.T) {
+	s, lamp, _ := testGateway(t, 0)
+	conn := testConnection(t, s)
+
+	b := &Bridge{Connection: conn, Broker: &MemoryBroker{}, Uris: []string{"15001/65537"}}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop(context.Background())
+
+	if err := b.Start(context.Background()); err != ErrorStarted {
+		t.Fatalf("second Start: got %v, want %v", err, ErrorStarted)
+	}
+	if lamp.Observers() != 1 {
+		t.Fatalf("got %d observers after the second Start, want 1", lamp.Observers())
+	}
+
+	// A stopped Bridge can be started again
+	if err := b.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if lamp.Observers() != 1 {
+		t.Fatalf("got %d observers after a restart, want 1", lamp.Observers())
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"gocoap/gw/15001", "gocoap/gw/15001", true},
+		{"gocoap/gw/15001", "gocoap/gw/15004", false},
+		{"gocoap/+/15001", "gocoap/gw/15001", true},
+		{"gocoap/+", "gocoap/gw/15001", false},
+		{"gocoap/#", "gocoap/gw/15001", true},
+		{"gocoap/gw/15001/#", "gocoap/gw", false},
+		{"gocoap/gw/15001/put", "gocoap/gw/15001", false},
+	}
+
+	for _, tt := range tests {
+		if got := TopicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("TopicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryBrokerRetained(t *testing.T) {
+	broker := &MemoryBroker{}
+	broker.Publish("gocoap/gw/15001", 0, true, []byte("[65537]"))
+	broker.Publish("gocoap/gw/15004", 0, false, []byte("[131073]"))
+
+	got := make(map[string]string)
+	broker.Subscribe("gocoap/gw/+", 0, func(topic string, payload []byte) {
+		got[topic] = string(payload)
+	})
+	if len(got) != 1 || got["gocoap/gw/15001"] != "[65537]" {
+		t.Errorf("got retained %v, want only gocoap/gw/15001", got)
+	}
+
+	broker.Publish("gocoap/gw/15001", 0, true, nil)
+	if _, ok := broker.Retained("gocoap/gw/15001"); ok {
+		t.Error("empty retained message did not clear the topic")
+	}
+}
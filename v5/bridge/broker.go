@@ -0,0 +1,130 @@
+package bridge
+
+import (
+	"strings"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Broker is the part of an MQTT client used by the bridge
+type Broker interface {
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+	Subscribe(topic string, qos byte, handler func(topic string, payload []byte)) error
+	Unsubscribe(topic string) error
+}
+
+// PahoBroker adapts a connected paho MQTT client to Broker
+type PahoBroker struct {
+	Client mqtt.Client
+}
+
+func (b *PahoBroker) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	token := b.Client.Publish(topic, qos, retained, payload)
+	token.Wait()
+	return token.Error()
+}
+
+func (b *PahoBroker) Subscribe(topic string, qos byte, handler func(topic string, payload []byte)) error {
+	token := b.Client.Subscribe(topic, qos, func(_ mqtt.Client, msg mqtt.Message) {
+		handler(msg.Topic(), msg.Payload())
+	})
+	token.Wait()
+	return token.Error()
+}
+
+func (b *PahoBroker) Unsubscribe(topic string) error {
+	token := b.Client.Unsubscribe(topic)
+	token.Wait()
+	return token.Error()
+}
+
+// MemoryBroker is an in-process broker with retained messages and wildcard subscriptions, for
+// running the bridge without an MQTT server
+type MemoryBroker struct {
+	mu            sync.Mutex
+	retained      map[string][]byte
+	subscriptions map[string]func(topic string, payload []byte)
+}
+
+func (b *MemoryBroker) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	b.mu.Lock()
+	if retained {
+		if b.retained == nil {
+			b.retained = make(map[string][]byte)
+		}
+		if len(payload) == 0 {
+			delete(b.retained, topic)
+		} else {
+			b.retained[topic] = payload
+		}
+	}
+
+	var handlers []func(string, []byte)
+	for filter, handler := range b.subscriptions {
+		if TopicMatches(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(topic, payload)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string, qos byte, handler func(topic string, payload []byte)) error {
+	b.mu.Lock()
+	if b.subscriptions == nil {
+		b.subscriptions = make(map[string]func(string, []byte))
+	}
+	b.subscriptions[topic] = handler
+
+	retained := make(map[string][]byte)
+	for t, payload := range b.retained {
+		if TopicMatches(topic, t) {
+			retained[t] = payload
+		}
+	}
+	b.mu.Unlock()
+
+	for t, payload := range retained {
+		handler(t, payload)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Unsubscribe(topic string) error {
+	b.mu.Lock()
+	delete(b.subscriptions, topic)
+	b.mu.Unlock()
+	return nil
+}
+
+// Retained returns the retained message for topic
+func (b *MemoryBroker) Retained(topic string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.retained[topic]
+	return payload, ok
+}
+
+// TopicMatches reports whether topic matches an MQTT topic filter with + and # wildcards
+func TopicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
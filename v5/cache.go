@@ -0,0 +1,181 @@
+package gocoap
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// Max-Age of responses without the option (RFC 7252 section 5.10.5)
+const defaultMaxAge = 60 * time.Second
+
+// Requests without an Accept option
+const noAccept = -1
+
+// ResponseCache caches 2.05 Content responses to GET requests on a CoapDTLSConnection. Entries are fresh
+// for their Max-Age, stale entries with an ETag are revalidated with the gateway. Successful PUT, POST
+// and DELETE requests and observe notifications invalidate the entries of their URI. Expired entries are
+// evicted when a response is stored, those with an ETag once they were stale for defaultMaxAge. The zero
+// value is an empty cache
+type ResponseCache struct {
+	mu          sync.Mutex
+	entries     map[cacheKey]*cacheEntry
+	hits        uint64
+	misses      uint64
+	revalidated uint64
+}
+
+// CacheStats counts cache lookups. Misses are requests sent to the gateway, Revalidated are the misses
+// answered with 2.03 Valid
+type CacheStats struct {
+	Hits        uint64
+	Misses      uint64
+	Revalidated uint64
+	Entries     int
+}
+
+type cacheKey struct {
+	uri    string
+	accept int
+}
+
+type cacheEntry struct {
+	response CoapResponse
+	etag     []byte
+	expires  time.Time
+}
+
+// NewResponseCache returns an empty ResponseCache
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{}
+}
+
+// Stats returns the hit and miss counts of the cache
+func (rc *ResponseCache) Stats() CacheStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return CacheStats{
+		Hits:        rc.hits,
+		Misses:      rc.misses,
+		Revalidated: rc.revalidated,
+		Entries:     len(rc.entries),
+	}
+}
+
+// Invalidate removes all entries of uri, including those with a query
+func (rc *ResponseCache) Invalidate(uri string) {
+	if rc == nil {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for key := range rc.entries {
+		if key.uri == uri || strings.HasPrefix(key.uri, uri+"?") {
+			delete(rc.entries, key)
+		}
+	}
+}
+
+// Clear removes all entries
+func (rc *ResponseCache) Clear() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.entries = nil
+}
+
+// get returns the cached response for uri if it is fresh. Otherwise it returns the options to send with
+// the request, an ETag when a stale entry can be revalidated
+func (rc *ResponseCache) get(uri string, accept int) (CoapResponse, bool, []message.Option) {
+	if rc == nil {
+		return CoapResponse{}, false, nil
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[cacheKey{uri, accept}]
+	if ok && time.Now().Before(entry.expires) {
+		rc.hits++
+		return entry.response, true, nil
+	}
+
+	rc.misses++
+	if ok && len(entry.etag) > 0 {
+		return CoapResponse{}, false, []message.Option{{ID: message.ETag, Value: entry.etag}}
+	}
+	return CoapResponse{}, false, nil
+}
+
+// valid refreshes the entry of uri when msg is a 2.03 Valid response and returns its cached response
+func (rc *ResponseCache) valid(uri string, accept int, msg CoapResponse) (CoapResponse, bool) {
+	if rc == nil || msg.Code != codes.Valid {
+		return CoapResponse{}, false
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[cacheKey{uri, accept}]
+	if !ok {
+		return CoapResponse{}, false
+	}
+
+	rc.revalidated++
+	entry.expires = time.Now().Add(maxAge(msg.Options))
+	return entry.response, true
+}
+
+// store caches msg if it is a 2.05 Content response that is fresh or can be revalidated
+func (rc *ResponseCache) store(uri string, accept int, response CoapResponse) {
+	if rc == nil || response.Code != codes.Content {
+		return
+	}
+
+	etag, _ := response.Options.GetBytes(message.ETag)
+	age := maxAge(response.Options)
+	if age == 0 && len(etag) == 0 {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.entries == nil {
+		rc.entries = make(map[cacheKey]*cacheEntry)
+	}
+	rc.evict(time.Now())
+	rc.entries[cacheKey{uri, accept}] = &cacheEntry{
+		response: response,
+		etag:     append([]byte(nil), etag...),
+		expires:  time.Now().Add(age),
+	}
+}
+
+// evict removes the entries that expired before now, entries with an ETag are kept for defaultMaxAge
+// longer to be revalidated. rc.mu must be held
+func (rc *ResponseCache) evict(now time.Time) {
+	for key, entry := range rc.entries {
+		expires := entry.expires
+		if len(entry.etag) > 0 {
+			expires = expires.Add(defaultMaxAge)
+		}
+		if now.After(expires) {
+			delete(rc.entries, key)
+		}
+	}
+}
+
+func maxAge(opts message.Options) time.Duration {
+	age, err := opts.GetUint32(message.MaxAge)
+	if err != nil {
+		return defaultMaxAge
+	}
+	return time.Duration(age) * time.Second
+}
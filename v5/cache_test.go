@@ -0,0 +1,155 @@
+package gocoap
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+func TestResponseCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxAge uint32
+		etag   []byte
+		ops    []string
+		gets   int32
+		stats  CacheStats
+	}{
+		{
+			name:   "hit",
+			maxAge: 60,
+			ops:    []string{"get", "get"},
+			gets:   1,
+			stats:  CacheStats{Hits: 1, Misses: 1, Entries: 1},
+		},
+		{
+			// The server adds an ETag to every response, the stale entry is kept for revalidation
+			name:  "max-age 0",
+			ops:   []string{"get", "get"},
+			gets:  2,
+			stats: CacheStats{Misses: 2, Entries: 1},
+		},
+		{
+			name:  "revalidated",
+			etag:  []byte{1},
+			ops:   []string{"get", "get"},
+			gets:  2,
+			stats: CacheStats{Misses: 2, Revalidated: 1, Entries: 1},
+		},
+		{
+			name:   "put invalidates",
+			maxAge: 60,
+			ops:    []string{"get", "put", "get"},
+			gets:   2,
+			stats:  CacheStats{Misses: 2, Entries: 1},
+		},
+		{
+			name:   "send invalidates",
+			maxAge: 60,
+			ops:    []string{"get", "send post", "get"},
+			gets:   2,
+			stats:  CacheStats{Misses: 2, Entries: 1},
+		},
+		{
+			name:   "send get hit",
+			maxAge: 60,
+			ops:    []string{"get", "send get"},
+			gets:   1,
+			stats:  CacheStats{Hits: 1, Misses: 1, Entries: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets int32
+			s := &CoapServer{}
+			s.HandleResponse("/15001/65536", GET, func(ServerRequest) ServerResponse {
+				n := atomic.AddInt32(&gets, 1)
+				opts := message.Options{}
+				buf := make([]byte, 8)
+				opts, _, _ = opts.SetUint32(buf, message.MaxAge, tt.maxAge)
+				if len(tt.etag) > 0 {
+					opts, _, _ = opts.SetBytes(buf[4:], message.ETag, tt.etag)
+					if n > 1 {
+						return ServerResponse{Code: codes.Valid, Options: opts}
+					}
+				}
+				return ServerResponse{Code: codes.Content, Options: opts, Payload: []byte(fmt.Sprintf(`{"5850":%d}`, n))}
+			})
+			s.Handle("/15001/65536", PUT, func(ServerRequest) ([]byte, error) { return nil, nil })
+			s.Handle("/15001/65536", POST, func(ServerRequest) ([]byte, error) { return nil, nil })
+			testServer(t, s)
+
+			conn := testConnection(t, s)
+			conn.Cache = NewResponseCache()
+
+			for _, op := range tt.ops {
+				var err error
+				switch op {
+				case "get":
+					conn.GET(context.Background(), "/15001/65536", func(m []byte, e error) { err = e })
+				case "put":
+					conn.PUT(context.Background(), "/15001/65536", `{"3311":[{"5850":1}]}`, func(m []byte, e error) { err = e })
+				case "send get", "send post":
+					method := GET
+					if op == "send post" {
+						method = POST
+					}
+					conn.Send(context.Background(), NewRequest(method, "/15001/65536"), func(response CoapResponse, e error) { err = e })
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", op, err)
+				}
+			}
+
+			if n := atomic.LoadInt32(&gets); n != tt.gets {
+				t.Errorf("got %d GET requests at the gateway, want %d", n, tt.gets)
+			}
+			if stats := conn.Cache.Stats(); stats != tt.stats {
+				t.Errorf("got stats %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}
+
+func TestResponseCacheConcurrent(t *testing.T) {
+	s := &CoapServer{}
+	s.Handle("/15001/65536", GET, func(ServerRequest) ([]byte, error) {
+		return []byte(`{"5850":1}`), nil
+	})
+	s.Handle("/15001/65536", PUT, func(ServerRequest) ([]byte, error) { return nil, nil })
+	testServer(t, s)
+
+	conn := testConnection(t, s)
+	conn.Cache = NewResponseCache()
+
+	// Lookups, stores and invalidations from several goroutines, for the race detector
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 10; j++ {
+				if i == 0 && j%3 == 0 {
+					conn.PUT(context.Background(), "/15001/65536", `{"3311":[{"5850":1}]}`, func([]byte, error) {})
+					continue
+				}
+				conn.GET(context.Background(), "/15001/65536", func(m []byte, err error) {
+					if err != nil || string(m) != `{"5850":1}` {
+						t.Errorf("got %q, %v", m, err)
+					}
+				})
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+
+	if stats := conn.Cache.Stats(); stats.Hits+stats.Misses != 36 {
+		t.Errorf("got %d lookups, want 36", stats.Hits+stats.Misses)
+	}
+}
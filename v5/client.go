@@ -0,0 +1,18 @@
+package gocoap
+
+import "context"
+
+// Client is the request API of CoapDTLSConnection, for code that should also run against FakeClient in
+// tests. Handlers are called with the payload of the response, or with the error of a failed request,
+// except when the exchange fails without a response: a GET is then queued and its handler is called when
+// it is sent again, and the handler of a PUT is not called at all, the error is only logged
+type Client interface {
+	GET(ctx context.Context, uri string, handler func([]byte, error))
+	PUT(ctx context.Context, uri string, payload string, handler func([]byte, error))
+	POST(ctx context.Context, uri string, payload string, handler func([]byte, error))
+	DELETE(ctx context.Context, uri string, handler func([]byte, error))
+	Observe(ctx context.Context, uri string, handler func([]byte, error)) (*CoapDTLSObservation, error)
+}
+
+var _ Client = (*CoapDTLSConnection)(nil)
+var _ Client = (*FakeClient)(nil)
@@ -0,0 +1,126 @@
+package gocoap
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Close shuts the connection down gracefully. New requests and observations fail with
+// ErrorConnectionClosed from the start of Close, and a connect or reconnect in progress is canceled. With
+// DrainOnClose the queued requests are sent once more if the connection is connected. Close then waits for
+// the requests in flight, disconnects, and calls the handlers of the requests left in the queue with
+// ErrorConnectionClosed. When ctx is done, draining stops, the connection is disconnected without waiting
+// for the requests in flight and ctx.Err() is returned. A closed connection can not be connected again
+func (c *CoapDTLSConnection) Close(ctx context.Context) error {
+	c.stateMu.Lock()
+	if c.closed {
+		c.stateMu.Unlock()
+		return nil
+	}
+	c.closed = true
+	cancel := c.cancel
+	c.stateMu.Unlock()
+
+	// Requests whose transport failed wait in HandleError for the reconnect, end it so they return
+	if cancel != nil {
+		cancel()
+	}
+
+	if c.DrainOnClose && c.status() == StateConnected {
+		c.drain(ctx)
+	}
+
+	var err error
+	select {
+	case <-c.idleChan():
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.Disconnect()
+
+	c.mu.Lock()
+	queue := c.queue
+	c.queue = nil
+	c.mu.Unlock()
+	c.metrics().QueueLength(c.addr(), 0)
+
+	for _, item := range queue {
+		item.Handler([]byte{}, ErrorConnectionClosed)
+	}
+	return err
+}
+
+// drain sends every queued request once, until ctx is done. Requests that fail get ErrorConnectionClosed
+func (c *CoapDTLSConnection) drain(ctx context.Context) {
+	c.mu.Lock()
+	queue := c.queue
+	c.queue = nil
+	c.mu.Unlock()
+	c.metrics().QueueLength(c.addr(), 0)
+
+	for i, item := range queue {
+		if ctx.Err() != nil {
+			c.mu.Lock()
+			c.queue = append(queue[i:], c.queue...)
+			c.mu.Unlock()
+			return
+		}
+
+		itemCtx, cancel := context.WithTimeout(withRetries(ctx, item.retries+1), c.requestTimeout(2*time.Second))
+		itemCtx, span := c.tracer().Start(itemCtx, "CoapDTLSConnection.Close",
+			trace.WithLinks(trace.Link{SpanContext: item.spanContext}),
+		)
+		c.get(itemCtx, item.Uri, item.Handler)
+		span.End()
+		cancel()
+	}
+}
+
+func (c *CoapDTLSConnection) isClosed() bool {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.closed
+}
+
+// begin registers a request in flight, it reports false when the connection is closed
+func (c *CoapDTLSConnection) begin() bool {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	c.inflight++
+	return true
+}
+
+// end unregisters a request in flight
+func (c *CoapDTLSConnection) end() {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	c.inflight--
+	if c.inflight == 0 && c.idle != nil {
+		close(c.idle)
+		c.idle = nil
+	}
+}
+
+// idleChan returns a channel that is closed when no requests are in flight
+func (c *CoapDTLSConnection) idleChan() <-chan struct{} {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	if c.inflight == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	if c.idle == nil {
+		c.idle = make(chan struct{})
+	}
+	return c.idle
+}
@@ -0,0 +1,188 @@
+package gocoap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testResult is the response of a request, as passed to its handler
+type testResult struct {
+	payload string
+	err     error
+}
+
+// testHandler returns a request handler that sends its result on the returned channel
+func testHandler() (func([]byte, error), chan testResult) {
+	results := make(chan testResult, 1)
+	return func(payload []byte, err error) {
+		results <- testResult{string(payload), err}
+	}, results
+}
+
+// waitResult waits for the result of a request
+func waitResult(t *testing.T, results chan testResult) testResult {
+	t.Helper()
+
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler not called")
+		return testResult{}
+	}
+}
+
+// closeWithin closes conn with ctx and fails the test when Close does not return within a second
+func closeWithin(t *testing.T, ctx context.Context, conn *CoapDTLSConnection) error {
+	t.Helper()
+
+	closed := make(chan error, 1)
+	go func() { closed <- conn.Close(ctx) }()
+
+	select {
+	case err := <-closed:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return")
+		return nil
+	}
+}
+
+func TestCloseQueued(t *testing.T) {
+	s := &CoapServer{}
+	s.Handle("/15001/65536", GET, func(ServerRequest) ([]byte, error) {
+		return []byte(`{"5850":1}`), nil
+	})
+	testServer(t, s)
+
+	conn := testConnection(t, s)
+	conn.UseQueue = true
+
+	// The GET fails on the transport and waits for the reconnect to the stopped server
+	s.Shutdown(context.Background())
+	handler, results := testHandler()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	go conn.GET(ctx, "/15001/65536", handler)
+
+	for start := time.Now(); conn.QueueLenght() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("request not queued")
+		}
+	}
+
+	if err := closeWithin(t, context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	if result := waitResult(t, results); !errors.Is(result.err, ErrorConnectionClosed) {
+		t.Fatalf("got error %v, want %v", result.err, ErrorConnectionClosed)
+	}
+	if n := conn.QueueLenght(); n != 0 {
+		t.Fatalf("got %d queued requests after Close, want none", n)
+	}
+}
+
+func TestCloseInFlight(t *testing.T) {
+	s := &CoapServer{}
+	s.Handle("/15001/65536", GET, func(ServerRequest) ([]byte, error) {
+		time.Sleep(300 * time.Millisecond)
+		return []byte(`{"5850":1}`), nil
+	})
+	testServer(t, s)
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		err     error
+		payload string
+	}{
+		{
+			name:    "waits",
+			timeout: time.Second,
+			payload: `{"5850":1}`,
+		},
+		{
+			name:    "expired",
+			timeout: 50 * time.Millisecond,
+			err:     context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := testConnection(t, s)
+
+			handler, results := testHandler()
+			go conn.GET(context.Background(), "/15001/65536", handler)
+			time.Sleep(100 * time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := closeWithin(t, ctx, conn); !errors.Is(err, tt.err) {
+				t.Fatalf("got Close error %v, want %v", err, tt.err)
+			}
+
+			result := waitResult(t, results)
+			if tt.err == nil && (result.err != nil || result.payload != tt.payload) {
+				t.Fatalf("got %q, %v, want %q", result.payload, result.err, tt.payload)
+			}
+			if tt.err != nil && result.err == nil {
+				t.Fatal("got no error for the request canceled by Close")
+			}
+		})
+	}
+}
+
+func TestCloseDrain(t *testing.T) {
+	s := &CoapServer{}
+	s.Handle("/15001/65536", GET, func(ServerRequest) ([]byte, error) {
+		return []byte(`{"5850":1}`), nil
+	})
+	testServer(t, s)
+
+	tests := []struct {
+		name  string
+		drain bool
+		err   error
+	}{
+		{
+			name:  "drain",
+			drain: true,
+		},
+		{
+			name: "no drain",
+			err:  ErrorConnectionClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := testConnection(t, s)
+			conn.DrainOnClose = tt.drain
+
+			var queued []chan testResult
+			for i := 0; i < 3; i++ {
+				handler, results := testHandler()
+				conn.AddToQueue(CoapDTLSRequest{Uri: "/15001/65536", Handler: handler})
+				queued = append(queued, results)
+			}
+
+			if err := closeWithin(t, context.Background(), conn); err != nil {
+				t.Fatal(err)
+			}
+			for _, results := range queued {
+				if result := waitResult(t, results); !errors.Is(result.err, tt.err) {
+					t.Fatalf("got error %v, want %v", result.err, tt.err)
+				}
+			}
+
+			handler, results := testHandler()
+			conn.GET(context.Background(), "/15001/65536", handler)
+			if result := waitResult(t, results); !errors.Is(result.err, ErrorConnectionClosed) {
+				t.Fatalf("got error %v after Close, want %v", result.err, ErrorConnectionClosed)
+			}
+		})
+	}
+}
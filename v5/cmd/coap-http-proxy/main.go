@@ -0,0 +1,298 @@
+// Command coap-http-proxy is an HTTP-to-CoAP reverse proxy (RFC 8075) for DTLS gateways.
+//
+// Requests to http://proxy/<gateway>/<path>?<query> are forwarded to <path> with the query on the
+// named gateway. A GET with "Accept: text/event-stream" observes the resource and streams every
+// notification as a Server-Sent Event until the HTTP client disconnects or the observation ends.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	coap "github.com/moroen/gocoap/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+type gatewayConfig struct {
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+	Ident string `json:"ident"`
+	Key   string `json:"key"`
+}
+
+type config struct {
+	Listen   string                   `json:"listen"`
+	Timeout  string                   `json:"timeout"`
+	Gateways map[string]gatewayConfig `json:"gateways"`
+}
+
+type proxy struct {
+	gateways map[string]*coap.CoapDTLSConnection
+	timeout  time.Duration
+}
+
+func loadConfig(path string) (config, error) {
+	var conf config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return conf, err
+	}
+
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return conf, err
+	}
+
+	if len(conf.Gateways) == 0 {
+		return conf, coap.ErrorNoConfig
+	}
+	return conf, nil
+}
+
+func main() {
+	configFile := flag.String("config", "coap-http-proxy.json", "Path to the gateway configuration")
+	listen := flag.String("listen", "", "HTTP listen address, overrides the configuration")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	conf, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Unable to load %s: %s", *configFile, err.Error())
+	}
+
+	if *listen != "" {
+		conf.Listen = *listen
+	}
+	if conf.Listen == "" {
+		conf.Listen = ":8080"
+	}
+
+	p := &proxy{
+		gateways: make(map[string]*coap.CoapDTLSConnection),
+		timeout:  5 * time.Second,
+	}
+
+	if conf.Timeout != "" {
+		if p.timeout, err = time.ParseDuration(conf.Timeout); err != nil {
+			log.Fatalf("Bad timeout %s: %s", conf.Timeout, err.Error())
+		}
+	}
+
+	for name, gw := range conf.Gateways {
+		if gw.Port == 0 {
+			gw.Port = 5684
+		}
+
+		// The keepalive detects a lost session, so requests recover after the gateway restarts
+		conn := &coap.CoapDTLSConnection{
+			Host:  gw.Host,
+			Port:  gw.Port,
+			Ident: gw.Ident,
+			Key:   gw.Key,
+			Keepalive: &coap.Keepalive{
+				Interval:  30 * time.Second,
+				Timeout:   5 * time.Second,
+				MaxMissed: 3,
+				Reconnect: true,
+			},
+		}
+		name := name
+		conn.OnConnect = func() {
+			log.WithFields(log.Fields{"Gateway": name}).Info("Connected")
+		}
+		conn.OnDisconnect = func() {
+			log.WithFields(log.Fields{"Gateway": name, "Reason": conn.DisconnectReason()}).Warn("Disconnected")
+		}
+		conn.OnConnectionFailed = func() {
+			log.WithFields(log.Fields{"Gateway": name}).Warn("Connection failed, retrying")
+		}
+		p.gateways[name] = conn
+
+		go conn.Connect()
+	}
+
+	server := &http.Server{
+		Addr:    conf.Listen,
+		Handler: p,
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		<-sig
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	log.WithFields(log.Fields{"Listen": conf.Listen}).Info("coap-http-proxy")
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err.Error())
+	}
+
+	for _, conn := range p.gateways {
+		conn.Disconnect()
+	}
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, uri := splitPath(r.URL.EscapedPath())
+
+	conn, ok := p.gateways[name]
+	if !ok || uri == "" {
+		http.Error(w, "Unknown gateway", http.StatusNotFound)
+		return
+	}
+
+	var method coap.RequestMethod
+	switch r.Method {
+	case http.MethodGet:
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			p.observe(w, r, conn, unescapePath(uri))
+			return
+		}
+		method = coap.GET
+	case http.MethodPut:
+		method = coap.PUT
+	case http.MethodPost:
+		method = coap.POST
+	case http.MethodDelete:
+		method = coap.DELETE
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cf, ok := contentFormat(r.Header.Get("Content-Type"))
+	if !ok {
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.timeout)
+	defer cancel()
+
+	req := coap.NewRequest(method, uri)
+	if r.URL.RawQuery != "" {
+		req.Query = strings.Split(r.URL.RawQuery, "&")
+	}
+	if method == coap.PUT || method == coap.POST {
+		req.WithContentFormat(cf).WithPayload(payload)
+	}
+
+	conn.Send(ctx, req, func(response coap.CoapResponse, err error) {
+		if response.Code == 0 {
+			writeError(w, err)
+			return
+		}
+
+		if response.HasContentFormat {
+			w.Header().Set("Content-Type", contentType(response.ContentFormat))
+		}
+		status := statusCode(response.Code, response.Payload)
+		w.WriteHeader(status)
+		if bodyAllowed(status) {
+			w.Write(response.Payload)
+		}
+	})
+}
+
+func (p *proxy) observe(w http.ResponseWriter, r *http.Request, conn *coap.CoapDTLSConnection, uri string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The observation lasts as long as the request, p.timeout only bounds the registration. ObserveChan ends
+	// the stream with ErrorConnectionLost when the session to the gateway is lost
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	registration := time.AfterFunc(p.timeout, cancel)
+	notifications, err := conn.ObserveChan(ctx, uri)
+	registration.Stop()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for notification := range notifications {
+		if notification.Stale {
+			continue
+		}
+		if notification.Err != nil {
+			// A notification with an error code ends the observation (RFC 7641 section 3.2)
+			log.WithFields(log.Fields{
+				"Uri":   uri,
+				"Error": notification.Err.Error(),
+			}).Debug("Observe")
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", notification.Err.Error())
+			flusher.Flush()
+			return
+		}
+		writeEvent(w, notification.Payload)
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes m as Server-Sent Event, with a data line for every line of m
+func writeEvent(w io.Writer, m []byte) {
+	fmt.Fprintf(w, "data: %s\n\n", strings.ReplaceAll(string(m), "\n", "\ndata: "))
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		http.Error(w, "Empty response", http.StatusBadGateway)
+	case errors.Is(err, coap.ErrorNotConnected):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
+
+// unescapePath decodes an escaped path, malformed escapes are left as they are
+func unescapePath(path string) string {
+	if decoded, err := url.PathUnescape(path); err == nil {
+		return decoded
+	}
+	return path
+}
+
+// splitPath splits /<gateway>/<path> into the gateway name and the CoAP uri
+func splitPath(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/")
+	i := strings.IndexByte(path, '/')
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i:]
+}
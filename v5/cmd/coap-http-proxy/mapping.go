@@ -0,0 +1,90 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// Response code mapping from RFC 8075 section 7
+var statusCodes = map[codes.Code]int{
+	codes.Created:               http.StatusCreated,
+	codes.Deleted:               http.StatusOK,
+	codes.Valid:                 http.StatusNotModified,
+	codes.Changed:               http.StatusNoContent,
+	codes.Content:               http.StatusOK,
+	codes.BadRequest:            http.StatusBadRequest,
+	codes.Unauthorized:          http.StatusForbidden,
+	codes.BadOption:             http.StatusBadRequest,
+	codes.Forbidden:             http.StatusForbidden,
+	codes.NotFound:              http.StatusNotFound,
+	codes.MethodNotAllowed:      http.StatusMethodNotAllowed,
+	codes.NotAcceptable:         http.StatusNotAcceptable,
+	codes.PreconditionFailed:    http.StatusPreconditionFailed,
+	codes.RequestEntityTooLarge: http.StatusRequestEntityTooLarge,
+	codes.UnsupportedMediaType:  http.StatusUnsupportedMediaType,
+	codes.InternalServerError:   http.StatusInternalServerError,
+	codes.NotImplemented:        http.StatusNotImplemented,
+	codes.BadGateway:            http.StatusBadGateway,
+	codes.ServiceUnavailable:    http.StatusServiceUnavailable,
+	codes.GatewayTimeout:        http.StatusGatewayTimeout,
+	codes.ProxyingNotSupported:  http.StatusBadGateway,
+}
+
+var contentTypes = map[message.MediaType]string{
+	message.TextPlain:         "text/plain; charset=utf-8",
+	message.AppLinkFormat:     "application/link-format",
+	message.AppXML:            "application/xml",
+	message.AppOctets:         "application/octet-stream",
+	message.AppExi:            "application/exi",
+	message.AppJSON:           "application/json",
+	message.AppJSONPatch:      "application/json-patch+json",
+	message.AppJSONMergePatch: "application/merge-patch+json",
+	message.AppCBOR:           "application/cbor",
+}
+
+// statusCode maps a response code to an HTTP status. 2.04 Changed is 204 No Content only without payload,
+// since a 204 response can't have a body
+func statusCode(code codes.Code, payload []byte) int {
+	if code == codes.Changed && len(payload) > 0 {
+		return http.StatusOK
+	}
+	if status, ok := statusCodes[code]; ok {
+		return status
+	}
+	return http.StatusBadGateway
+}
+
+// bodyAllowed reports whether a response with status can have a body, 2.03 Valid maps to 304 Not Modified
+// and is sent without the payload
+func bodyAllowed(status int) bool {
+	return status != http.StatusNotModified && status != http.StatusNoContent
+}
+
+func contentType(cf message.MediaType) string {
+	if ct, ok := contentTypes[cf]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// contentFormat maps a request Content-Type to a CoAP content-format, defaulting to JSON
+func contentFormat(ct string) (message.MediaType, bool) {
+	if ct == "" {
+		return message.AppJSON, true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return 0, false
+	}
+
+	for cf, t := range contentTypes {
+		if m, _, _ := mime.ParseMediaType(t); m == mediaType {
+			return cf, true
+		}
+	}
+	return 0, false
+}
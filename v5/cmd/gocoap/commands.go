@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+
+	coap "github.com/moroen/gocoap/v5"
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+func (c *cli) get(args []string) error {
+	return c.request(coap.GET, args[0], "")
+}
+
+func (c *cli) put(args []string) error {
+	return c.request(coap.PUT, args[0], args[1])
+}
+
+func (c *cli) post(args []string) error {
+	return c.request(coap.POST, args[0], args[1])
+}
+
+func (c *cli) delete(args []string) error {
+	return c.request(coap.DELETE, args[0], "")
+}
+
+func (c *cli) request(method coap.RequestMethod, uri string, payload string) error {
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Disconnect()
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	var result error
+	conn.Do(ctx, method, uri, message.AppJSON, []byte(payload), func(response coap.CoapResponse, err error) {
+		if response.Code != 0 && c.verbose {
+			c.printResponse(response)
+		}
+		if len(response.Payload) > 0 {
+			c.printPayload(response.Payload)
+		}
+		result = err
+	})
+	return result
+}
+
+func (c *cli) observe(args []string) error {
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Disconnect()
+
+	var observations []*coap.CoapDTLSObservation
+	for _, uri := range args {
+		uri := uri
+		ctx, cancel := c.context()
+		obs, err := conn.Observe(ctx, uri, func(m []byte, err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", uri, err.Error())
+				return
+			}
+			if len(args) > 1 || c.verbose {
+				fmt.Printf("%s:\n", uri)
+			}
+			c.printPayload(m)
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+		observations = append(observations, obs)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+
+	for _, obs := range observations {
+		ctx, cancel := c.context()
+		obs.Cancel(ctx)
+		cancel()
+	}
+	return nil
+}
+
+func (c *cli) discover(args []string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	devices, err := coap.Discover(ctx, coap.DiscoverParams{Timeout: c.timeout / 2})
+	if err != nil && err != coap.ErrorNoInterfaces {
+		return err
+	}
+	for _, dev := range devices {
+		fmt.Printf("coap://%s\n", dev.Addr.String())
+		if c.verbose {
+			for _, link := range dev.Links {
+				fmt.Printf("  <%s> %v\n", link.Target, link.Attributes)
+			}
+		}
+	}
+
+	entries, err := coap.Browse(ctx, coap.BrowseParams{Timeout: c.timeout / 2})
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		scheme := "coap"
+		if entry.Service == coap.CoapsService {
+			scheme = "coaps"
+		}
+		fmt.Printf("%s://%s:%d %s\n", scheme, entry.Addr(), entry.Port, entry.Instance)
+		if c.verbose {
+			for k, v := range entry.Text {
+				fmt.Printf("  %s=%s\n", k, v)
+			}
+		}
+	}
+	return nil
+}
+
+// registerIdentity registers a new PSK identity with a TRÅDFRI gateway, using the security code
+// printed on the gateway, and stores the returned key in the config file
+func (c *cli) registerIdentity(args []string) error {
+	payload, err := json.Marshal(map[string]string{"9090": args[1]})
+	if err != nil {
+		return err
+	}
+
+	response, err := coap.PostRequest(coap.RequestParams{
+		Host:    c.conf.Host,
+		Port:    c.conf.Port,
+		Uri:     "/15011/9063",
+		Id:      "Client_identity",
+		Key:     args[0],
+		Payload: string(payload),
+	})
+	coap.CloseDTLSConnection()
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Key     string `json:"9091"`
+		Version string `json:"9029"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil || result.Key == "" {
+		return coap.ErrorBadData
+	}
+
+	c.conf.Ident = args[1]
+	c.conf.Key = result.Key
+
+	if err := saveConfig(c.configFile, c.conf); err != nil {
+		return err
+	}
+
+	fmt.Printf("Registered %s (gateway version %s), key saved to %s\n", c.conf.Ident, result.Version, c.configFile)
+	return nil
+}
+
+func (c *cli) printResponse(response coap.CoapResponse) {
+	fmt.Fprintf(os.Stderr, "Code: %s\n", response.Code.String())
+	for _, opt := range response.Options {
+		def, ok := message.CoapOptionDefs[opt.ID]
+		switch {
+		case ok && def.ValueFormat == message.ValueUint:
+			v, _, _ := message.DecodeUint32(opt.Value)
+			if opt.ID == message.ContentFormat || opt.ID == message.Accept {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", opt.ID.String(), message.MediaType(v).String())
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %d\n", opt.ID.String(), v)
+			}
+		case ok && def.ValueFormat == message.ValueString:
+			fmt.Fprintf(os.Stderr, "%s: %s\n", opt.ID.String(), opt.Value)
+		default:
+			fmt.Fprintf(os.Stderr, "%s: %x\n", opt.ID.String(), opt.Value)
+		}
+	}
+}
+
+func (c *cli) printPayload(m []byte) {
+	var out bytes.Buffer
+	if !c.raw && json.Indent(&out, m, "", "  ") == nil {
+		fmt.Println(out.String())
+		return
+	}
+	fmt.Println(string(m))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type config struct {
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+	Ident string `json:"ident"`
+	Key   string `json:"key"`
+}
+
+func defaultConfigFile() string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "gocoap", "config.json")
+	}
+	return "gocoap.json"
+}
+
+// loadConfig reads the config file, then overrides it with GOCOAP_* environment variables and
+// finally with any flags given on the command line
+func loadConfig(path string, flags config, set map[string]bool) (config, error) {
+	var conf config
+
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &conf); err != nil {
+			return conf, err
+		}
+	} else if !os.IsNotExist(err) {
+		return conf, err
+	}
+
+	if v, ok := os.LookupEnv("GOCOAP_HOST"); ok {
+		conf.Host = v
+	}
+	if v, ok := os.LookupEnv("GOCOAP_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return conf, err
+		}
+		conf.Port = port
+	}
+	if v, ok := os.LookupEnv("GOCOAP_IDENT"); ok {
+		conf.Ident = v
+	}
+	if v, ok := os.LookupEnv("GOCOAP_KEY"); ok {
+		conf.Key = v
+	}
+
+	if set["host"] {
+		conf.Host = flags.Host
+	}
+	if set["port"] {
+		conf.Port = flags.Port
+	}
+	if set["ident"] {
+		conf.Ident = flags.Ident
+	}
+	if set["key"] {
+		conf.Key = flags.Key
+	}
+
+	if conf.Port == 0 {
+		conf.Port = 5684
+	}
+
+	return conf, nil
+}
+
+func saveConfig(path string, conf config) error {
+	data, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func flagsSet(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
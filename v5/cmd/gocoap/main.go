@@ -0,0 +1,135 @@
+// Command gocoap is a command-line client for CoAP DTLS gateways.
+//
+// Usage:
+//
+//	gocoap [flags] get <uri>
+//	gocoap [flags] put <uri> <payload>
+//	gocoap [flags] post <uri> <payload>
+//	gocoap [flags] delete <uri>
+//	gocoap [flags] observe <uri>...
+//	gocoap [flags] discover
+//	gocoap [flags] register-identity <security-code> <ident>
+//
+// Host, port, ident and key are read from the config file, then from the GOCOAP_HOST, GOCOAP_PORT,
+// GOCOAP_IDENT and GOCOAP_KEY environment variables, and finally from flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	coap "github.com/moroen/gocoap/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+type command struct {
+	args    string
+	minArgs int
+	run     func(*cli, []string) error
+}
+
+var commands = map[string]command{
+	"get":               {"<uri>", 1, (*cli).get},
+	"put":               {"<uri> <payload>", 2, (*cli).put},
+	"post":              {"<uri> <payload>", 2, (*cli).post},
+	"delete":            {"<uri>", 1, (*cli).delete},
+	"observe":           {"<uri>...", 1, (*cli).observe},
+	"discover":          {"", 0, (*cli).discover},
+	"register-identity": {"<security-code> <ident>", 2, (*cli).registerIdentity},
+}
+
+type cli struct {
+	conf       config
+	configFile string
+	timeout    time.Duration
+	verbose    bool
+	raw        bool
+}
+
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] <command> [args]\n\nCommands:\n", os.Args[0])
+		for _, name := range []string{"get", "put", "post", "delete", "observe", "discover", "register-identity"} {
+			fmt.Fprintf(fs.Output(), "  %s %s\n", name, commands[name].args)
+		}
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+}
+
+func main() {
+	var flags config
+	c := &cli{}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&flags.Host, "host", "", "Gateway host")
+	fs.IntVar(&flags.Port, "port", 5684, "Gateway port")
+	fs.StringVar(&flags.Ident, "ident", "", "PSK identity")
+	fs.StringVar(&flags.Key, "key", "", "PSK key")
+	fs.StringVar(&c.configFile, "config", defaultConfigFile(), "Config file")
+	fs.DurationVar(&c.timeout, "timeout", 5*time.Second, "Request timeout")
+	fs.BoolVar(&c.verbose, "v", false, "Print response codes and options")
+	fs.BoolVar(&c.raw, "raw", false, "Do not pretty-print JSON payloads")
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	fs.Usage = usage(fs)
+	fs.Parse(os.Args[1:])
+
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok || fs.NArg()-1 < cmd.minArgs {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	conf, err := loadConfig(c.configFile, flags, flagsSet(fs))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	c.conf = conf
+
+	if err := cmd.run(c, fs.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// connect dials the gateway once, without the retry loop of CoapDTLSConnection.Connect
+func (c *cli) connect() (*coap.CoapDTLSConnection, error) {
+	if c.conf.Host == "" {
+		return nil, coap.ErrorNoConfig
+	}
+
+	conn := &coap.CoapDTLSConnection{
+		Host:  c.conf.Host,
+		Port:  c.conf.Port,
+		Ident: c.conf.Ident,
+		Key:   c.conf.Key,
+	}
+	conn.OnConnect = func() {}
+	conn.OnConnectionFailed = func() {
+		conn.Disconnect()
+	}
+
+	if err := conn.Connect(); err != nil {
+		return nil, coap.ErrorHandshake
+	}
+	return conn, nil
+}
+
+func (c *cli) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.timeout)
+}
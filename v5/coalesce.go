@@ -0,0 +1,80 @@
+package gocoap
+
+import "sync"
+
+// coalescer tracks the GET exchanges in flight on a connection
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*getCall
+}
+
+type getCall struct {
+	mu       sync.Mutex
+	done     chan struct{}
+	left     bool
+	answered bool
+	payload  []byte
+	err      error
+}
+
+// join returns the call in flight for uri. leader is true when there was none and the caller must
+// perform the exchange and call leave when it is done
+func (g *coalescer) join(uri string) (call *getCall, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if call, ok := g.calls[uri]; ok {
+		return call, false
+	}
+
+	if g.calls == nil {
+		g.calls = make(map[string]*getCall)
+	}
+	call = &getCall{done: make(chan struct{})}
+	g.calls[uri] = call
+	return call, true
+}
+
+// leave removes the call and releases the callers waiting for it, calls after the first have no effect.
+// If the handler of the leader was not called the request has been queued, and the waiters send their own
+// requests
+func (g *coalescer) leave(uri string, call *getCall) {
+	call.mu.Lock()
+	if call.left {
+		call.mu.Unlock()
+		return
+	}
+	call.left = true
+	call.mu.Unlock()
+
+	g.mu.Lock()
+	if g.calls[uri] == call {
+		delete(g.calls, uri)
+	}
+	g.mu.Unlock()
+	close(call.done)
+}
+
+// wrap records a copy of the result passed to handler for the waiting callers and leaves the call before
+// handler runs, so the handler of the leader can request uri again without waiting for itself
+func (g *coalescer) wrap(uri string, call *getCall, handler func([]byte, error)) func([]byte, error) {
+	return func(m []byte, err error) {
+		call.mu.Lock()
+		if !call.left {
+			call.answered = true
+			call.payload = append([]byte{}, m...)
+			call.err = err
+		}
+		call.mu.Unlock()
+		g.leave(uri, call)
+		handler(m, err)
+	}
+}
+
+// result returns a copy of the payload, so handlers can't modify each others results. ok is false when
+// the leader's request was queued
+func (call *getCall) result() (m []byte, err error, ok bool) {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	return append([]byte{}, call.payload...), call.err, call.answered
+}
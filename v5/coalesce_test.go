@@ -0,0 +1,118 @@
+package gocoap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceGets(t *testing.T) {
+	tests := []struct {
+		name     string
+		coalesce bool
+		uris     []string
+		gets     int32
+		err      error
+	}{
+		{
+			name:     "shared",
+			coalesce: true,
+			uris:     []string{"/15001/65536", "/15001/65536", "/15001/65536", "/15001/65536"},
+			gets:     1,
+		},
+		{
+			name:     "shared error",
+			coalesce: true,
+			uris:     []string{"/15001/65537", "/15001/65537", "/15001/65537"},
+			gets:     1,
+			err:      UriNotFound,
+		},
+		{
+			name:     "other uris",
+			coalesce: true,
+			uris:     []string{"/15001/65536", "/15001/65538", "/15001/65536"},
+			gets:     2,
+		},
+		{
+			name: "disabled",
+			uris: []string{"/15001/65536", "/15001/65536", "/15001/65536"},
+			gets: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets int32
+			handler := func(req ServerRequest) ([]byte, error) {
+				atomic.AddInt32(&gets, 1)
+				// Slow enough for all requests to be in flight together
+				time.Sleep(200 * time.Millisecond)
+				if req.Uri == "15001/65537" {
+					return nil, UriNotFound
+				}
+				return []byte("/" + req.Uri), nil
+			}
+			s := &CoapServer{}
+			for _, uri := range []string{"/15001/65536", "/15001/65537", "/15001/65538"} {
+				s.Handle(uri, GET, handler)
+			}
+			testServer(t, s)
+
+			conn := testConnection(t, s)
+			conn.CoalesceGets = tt.coalesce
+
+			var wg sync.WaitGroup
+			for _, uri := range tt.uris {
+				wg.Add(1)
+				go func(uri string) {
+					defer wg.Done()
+					conn.GET(context.Background(), uri, func(m []byte, err error) {
+						if !errors.Is(err, tt.err) {
+							t.Errorf("%s: got error %v, want %v", uri, err, tt.err)
+						}
+						if tt.err == nil && string(m) != uri {
+							t.Errorf("%s: got %q", uri, m)
+						}
+						// Handlers get their own copy of the shared payload
+						for i := range m {
+							m[i] = 0
+						}
+					})
+				}(uri)
+			}
+			wg.Wait()
+
+			if n := atomic.LoadInt32(&gets); n != tt.gets {
+				t.Errorf("got %d GET requests at the gateway, want %d", n, tt.gets)
+			}
+		})
+	}
+}
+
+func TestCoalesceGetsAgainFromHandler(t *testing.T) {
+	s := &CoapServer{}
+	s.Handle("/15001/65536", GET, func(ServerRequest) ([]byte, error) {
+		return []byte(`{"5850":1}`), nil
+	})
+	testServer(t, s)
+
+	conn := testConnection(t, s)
+	conn.CoalesceGets = true
+
+	// The handler of the leader requests the uri again, it must not wait for its own exchange
+	done := make(chan struct{})
+	go conn.GET(context.Background(), "/15001/65536", func([]byte, error) {
+		conn.GET(context.Background(), "/15001/65536", func([]byte, error) {
+			close(done)
+		})
+	})
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("GET from the handler of the leader did not return")
+	}
+}
@@ -0,0 +1,303 @@
+// Package coap provides the message type of github.com/dustin/go-coap for the v3 compatibility package.
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+)
+
+// COAPType is the type of a message
+type COAPType uint8
+
+const (
+	Confirmable     COAPType = 0
+	NonConfirmable  COAPType = 1
+	Acknowledgement COAPType = 2
+	Reset           COAPType = 3
+)
+
+// COAPCode is the request method or response code of a message
+type COAPCode uint8
+
+const (
+	GET    COAPCode = 1
+	POST   COAPCode = 2
+	PUT    COAPCode = 3
+	DELETE COAPCode = 4
+
+	Created               COAPCode = 65
+	Deleted               COAPCode = 66
+	Valid                 COAPCode = 67
+	Changed               COAPCode = 68
+	Content               COAPCode = 69
+	BadRequest            COAPCode = 128
+	Unauthorized          COAPCode = 129
+	BadOption             COAPCode = 130
+	Forbidden             COAPCode = 131
+	NotFound              COAPCode = 132
+	MethodNotAllowed      COAPCode = 133
+	NotAcceptable         COAPCode = 134
+	PreconditionFailed    COAPCode = 140
+	RequestEntityTooLarge COAPCode = 141
+	UnsupportedMediaType  COAPCode = 143
+	InternalServerError   COAPCode = 160
+	NotImplemented        COAPCode = 161
+	BadGateway            COAPCode = 162
+	ServiceUnavailable    COAPCode = 163
+	GatewayTimeout        COAPCode = 164
+	ProxyingNotSupported  COAPCode = 165
+)
+
+// OptionID identifies an option in a message
+type OptionID uint8
+
+const (
+	IfMatch       OptionID = 1
+	URIHost       OptionID = 3
+	ETag          OptionID = 4
+	IfNoneMatch   OptionID = 5
+	Observe       OptionID = 6
+	URIPort       OptionID = 7
+	LocationPath  OptionID = 8
+	URIPath       OptionID = 11
+	ContentFormat OptionID = 12
+	MaxAge        OptionID = 14
+	URIQuery      OptionID = 15
+	Accept        OptionID = 17
+	LocationQuery OptionID = 20
+	ProxyURI      OptionID = 35
+	ProxyScheme   OptionID = 39
+	Size1         OptionID = 60
+)
+
+// MediaType is the value of the ContentFormat and Accept options
+type MediaType uint16
+
+const (
+	TextPlain     MediaType = 0
+	AppLinkFormat MediaType = 40
+	AppXML        MediaType = 41
+	AppOctets     MediaType = 42
+	AppExi        MediaType = 47
+	AppJSON       MediaType = 50
+)
+
+// ErrorOptionValue is returned by MarshalBinary for option values of unsupported types
+var ErrorOptionValue = errors.New("coap: unsupported option value")
+
+type option struct {
+	ID    OptionID
+	Value interface{}
+}
+
+// Message is a CoAP message, with the fields and methods of the coap.Message of github.com/dustin/go-coap.
+// Option values are strings, []byte, MediaType or unsigned integers
+type Message struct {
+	Type      COAPType
+	Code      COAPCode
+	MessageID uint16
+	Token     []byte
+	Payload   []byte
+
+	opts []option
+}
+
+// IsConfirmable returns true if this message is confirmable
+func (m Message) IsConfirmable() bool {
+	return m.Type == Confirmable
+}
+
+// Options returns all values of the option
+func (m Message) Options(o OptionID) []interface{} {
+	var values []interface{}
+	for _, opt := range m.opts {
+		if opt.ID == o {
+			values = append(values, opt.Value)
+		}
+	}
+	return values
+}
+
+// Option returns the first value of the option, or nil
+func (m Message) Option(o OptionID) interface{} {
+	for _, opt := range m.opts {
+		if opt.ID == o {
+			return opt.Value
+		}
+	}
+	return nil
+}
+
+// Path returns the URI path segments
+func (m Message) Path() []string {
+	var path []string
+	for _, v := range m.Options(URIPath) {
+		path = append(path, v.(string))
+	}
+	return path
+}
+
+// PathString returns the URI path
+func (m Message) PathString() string {
+	return strings.Join(m.Path(), "/")
+}
+
+// SetPathString sets the URI path from a slash separated string
+func (m *Message) SetPathString(s string) {
+	s = strings.Trim(s, "/")
+	if s == "" {
+		m.RemoveOption(URIPath)
+		return
+	}
+	m.SetPath(strings.Split(s, "/"))
+}
+
+// SetPath sets the URI path segments
+func (m *Message) SetPath(s []string) {
+	m.RemoveOption(URIPath)
+	for _, segment := range s {
+		m.AddOption(URIPath, segment)
+	}
+}
+
+// RemoveOption removes all values of the option
+func (m *Message) RemoveOption(opt OptionID) {
+	opts := m.opts[:0]
+	for _, o := range m.opts {
+		if o.ID != opt {
+			opts = append(opts, o)
+		}
+	}
+	m.opts = opts
+}
+
+// AddOption adds a value to the option
+func (m *Message) AddOption(opt OptionID, val interface{}) {
+	m.opts = append(m.opts, option{ID: opt, Value: val})
+}
+
+// SetOption replaces the values of the option with val
+func (m *Message) SetOption(opt OptionID, val interface{}) {
+	m.RemoveOption(opt)
+	m.AddOption(opt, val)
+}
+
+// MarshalBinary encodes the message for UDP
+func (m *Message) MarshalBinary() ([]byte, error) {
+	opts, err := m.options()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := udpMessage.Message{
+		Code:      codes.Code(m.Code),
+		Token:     m.Token,
+		Payload:   m.Payload,
+		MessageID: m.MessageID,
+		Type:      udpMessage.Type(m.Type),
+		Options:   opts,
+	}
+	return msg.Marshal()
+}
+
+// UnmarshalBinary decodes a message received over UDP
+func (m *Message) UnmarshalBinary(data []byte) error {
+	msg := udpMessage.Message{Options: make(message.Options, 0, 16)}
+	if _, err := msg.Unmarshal(data); err != nil {
+		return err
+	}
+
+	*m = Message{
+		Type:      COAPType(msg.Type),
+		Code:      COAPCode(msg.Code),
+		MessageID: msg.MessageID,
+		Token:     msg.Token,
+		Payload:   msg.Payload,
+	}
+	m.setOptions(msg.Options)
+	return nil
+}
+
+// ParseMessage decodes a message received over UDP
+func ParseMessage(data []byte) (Message, error) {
+	var m Message
+	err := m.UnmarshalBinary(data)
+	return m, err
+}
+
+func (m *Message) options() (message.Options, error) {
+	opts := make(message.Options, 0, len(m.opts))
+	for _, o := range m.opts {
+		value, err := encodeOption(o.Value)
+		if err != nil {
+			return nil, err
+		}
+		opts = opts.Add(message.Option{ID: message.OptionID(o.ID), Value: value})
+	}
+	return opts, nil
+}
+
+func (m *Message) setOptions(opts message.Options) {
+	for _, o := range opts {
+		m.AddOption(OptionID(o.ID), decodeOption(o.ID, o.Value))
+	}
+}
+
+func encodeOption(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case MediaType:
+		return encodeUint(uint32(v)), nil
+	case int:
+		return encodeUint(uint32(v)), nil
+	case uint:
+		return encodeUint(uint32(v)), nil
+	case uint8:
+		return encodeUint(uint32(v)), nil
+	case uint16:
+		return encodeUint(uint32(v)), nil
+	case uint32:
+		return encodeUint(v), nil
+	}
+	return nil, ErrorOptionValue
+}
+
+// encodeUint encodes v in as few bytes as possible, zero is the empty value
+func encodeUint(v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	for len(buf) > 0 && buf[0] == 0 {
+		buf = buf[1:]
+	}
+	return buf
+}
+
+func decodeOption(id message.OptionID, value []byte) interface{} {
+	def, ok := message.CoapOptionDefs[id]
+	if !ok {
+		return append([]byte{}, value...)
+	}
+
+	switch def.ValueFormat {
+	case message.ValueUint:
+		var v uint32
+		for _, b := range value {
+			v = v<<8 | uint32(b)
+		}
+		if id == message.ContentFormat || id == message.Accept {
+			return MediaType(v)
+		}
+		return v
+	case message.ValueString:
+		return string(value)
+	}
+	return append([]byte{}, value...)
+}
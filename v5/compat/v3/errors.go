@@ -0,0 +1,41 @@
+package gocoap
+
+import gocoap "github.com/moroen/gocoap/v5"
+
+// The errors are those of v5, so errors.Is works across both packages
+
+// ErrorTimeout error
+var ErrorTimeout = gocoap.ErrorTimeout
+
+// ErrorBadIdent error
+var ErrorBadIdent = gocoap.ErrorBadIdent
+
+// ErrorHandshake error
+var ErrorHandshake = gocoap.ErrorHandshake
+
+// ErrorReadTimeout error
+var ErrorReadTimeout = gocoap.ErrorReadTimeout
+
+// ErrorWriteTimeout error
+var ErrorWriteTimeout = gocoap.ErrorWriteTimeout
+
+// ErrorNoConfig error
+var ErrorNoConfig = gocoap.ErrorNoConfig
+
+// MethodNotAllowed error
+var MethodNotAllowed = gocoap.MethodNotAllowed
+
+// UriNotFound
+var UriNotFound = gocoap.UriNotFound
+
+// Unauthorized
+var Unauthorized = gocoap.Unauthorized
+
+// BadRequest
+var BadRequest = gocoap.BadRequest
+
+// ErrorBadData
+var ErrorBadData = gocoap.ErrorBadData
+
+// ErrorUnknowError
+var ErrorUnknownError = gocoap.ErrorUnknownError
@@ -0,0 +1,260 @@
+// Package gocoap provides the API of github.com/moroen/gocoap/v3 on the plgd/pion transport of v5.
+//
+// Code written against v3 migrates by replacing the imports of github.com/moroen/gocoap/v3 with
+// github.com/moroen/gocoap/v5/compat/v3 and of github.com/dustin/go-coap with
+// github.com/moroen/gocoap/v5/compat/v3/coap.
+package gocoap
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moroen/gocoap/v5/compat/v3/coap"
+	piondtls "github.com/pion/dtls/v2"
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+type RequestParams struct {
+	Host    string
+	Port    int
+	Uri     string
+	Id      string
+	Key     string
+	Req     coap.Message
+	Payload string
+}
+
+var _mu sync.Mutex
+var _connection *client.ClientConn
+
+var _retryLimit = 3
+
+// Time to wait for a response, as the read timeout of v3
+const _readTimeout = time.Second
+
+func _processMessage(msg coap.Message) error {
+	switch msg.Code {
+	case coap.MethodNotAllowed:
+		return MethodNotAllowed
+	case coap.NotFound:
+		return UriNotFound
+	case coap.Content:
+		return nil
+	case coap.Changed:
+		return nil
+	case coap.Created:
+		return nil
+	case coap.BadRequest:
+		return BadRequest
+	case coap.Unauthorized:
+		return Unauthorized
+	}
+
+	return ErrorUnknownError
+}
+
+// do sends req on conn and returns the response
+func do(conn *client.ClientConn, req coap.Message) (coap.Message, error) {
+	data, err := req.MarshalBinary()
+	if err != nil {
+		return coap.Message{}, ErrorUnknownError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), _readTimeout)
+	defer cancel()
+
+	msg := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(msg)
+	if _, err := msg.Unmarshal(data); err != nil {
+		return coap.Message{}, ErrorUnknownError
+	}
+	if len(msg.Token()) == 0 {
+		token, err := message.GetToken()
+		if err != nil {
+			return coap.Message{}, ErrorUnknownError
+		}
+		msg.SetToken(token)
+	}
+
+	resp, err := conn.Do(msg)
+	if err != nil {
+		return coap.Message{}, err
+	}
+	defer pool.ReleaseMessage(resp)
+
+	data, err = resp.Marshal()
+	if err != nil {
+		return coap.Message{}, ErrorBadData
+	}
+	// data is the buffer of resp, which is reused once resp is released, and the parsed message refers to it
+	response, err := coap.ParseMessage(append([]byte(nil), data...))
+	if err != nil {
+		return coap.Message{}, ErrorBadData
+	}
+	return response, nil
+}
+
+func _request(params RequestParams) (retmsg coap.Message, err error) {
+	conn, err := udp.Dial(net.JoinHostPort(params.Host, strconv.Itoa(params.Port)))
+	if err != nil {
+		return retmsg, err
+	}
+	defer conn.Close()
+
+	resp, err := do(conn, params.Req)
+	if err != nil {
+		return retmsg, err
+	}
+
+	err = _processMessage(resp)
+
+	return resp, err
+}
+
+func getDTLSConnection(params RequestParams) (*client.ClientConn, error) {
+	_mu.Lock()
+	defer _mu.Unlock()
+
+	if _connection != nil {
+		return _connection, nil
+	}
+
+	config := &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte(params.Key), nil
+		},
+		PSKIdentityHint: []byte(params.Id),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+
+	for i := 0; i < _retryLimit; i++ {
+		conn, err := dtls.Dial(net.JoinHostPort(params.Host, strconv.Itoa(params.Port)), config)
+		if err == nil {
+			_connection = conn
+			return conn, nil
+		}
+	}
+	return nil, ErrorHandshake
+}
+
+// SetRetryLimit sets number of retries, default i 3
+func SetRetryLimit(limit int) {
+	_retryLimit = limit
+}
+
+// CloseDTLSConnection closes the connection
+func CloseDTLSConnection() error {
+	_mu.Lock()
+	defer _mu.Unlock()
+
+	if _connection != nil {
+		_connection.Close()
+	}
+
+	_connection = nil
+
+	return nil
+}
+
+func _requestDTLS(params RequestParams, retry int) (retmsg coap.Message, err error) {
+	conn, err := getDTLSConnection(params)
+	if err != nil {
+		return coap.Message{}, err
+	}
+
+	msg, err := do(conn, params.Req)
+	if err == ErrorUnknownError || err == ErrorBadData {
+		return coap.Message{}, err
+	}
+	if err != nil {
+		CloseDTLSConnection()
+
+		if retry < _retryLimit {
+			return _requestDTLS(params, retry+1)
+		}
+		return coap.Message{}, ErrorReadTimeout
+	}
+
+	if msg.Code == coap.Changed {
+		params.Req.Code = coap.GET
+		params.Req.Payload = nil
+		msg, err = _requestDTLS(params, 0)
+		if err != nil {
+			return msg, err
+		}
+	}
+
+	err = _processMessage(msg)
+	return msg, err
+}
+
+// GetRequest sends a default get
+func GetRequest(params RequestParams) (response []byte, err error) {
+	params.Req = coap.Message{
+		Type:      coap.Confirmable,
+		Code:      coap.GET,
+		MessageID: 1,
+	}
+
+	params.Req.SetPathString(params.Uri)
+
+	var msg coap.Message
+
+	if params.Id != "" {
+		msg, err = _requestDTLS(params, 0)
+	} else {
+		msg, err = _request(params)
+	}
+	return msg.Payload, err
+}
+
+// PutRequest sends a default Put-request
+func PutRequest(params RequestParams) (response []byte, err error) {
+	params.Req = coap.Message{
+		Type:      coap.Confirmable,
+		Code:      coap.PUT,
+		MessageID: 1,
+		Payload:   []byte(params.Payload),
+	}
+
+	params.Req.SetPathString(params.Uri)
+
+	var msg coap.Message
+
+	if params.Id != "" {
+		msg, err = _requestDTLS(params, 0)
+	} else {
+		msg, err = _request(params)
+	}
+
+	return msg.Payload, err
+}
+
+// PostRequest sends a default Post-request
+func PostRequest(params RequestParams) (response []byte, err error) {
+	params.Req = coap.Message{
+		Type:      coap.Confirmable,
+		Code:      coap.POST,
+		MessageID: 1,
+		Payload:   []byte(params.Payload),
+	}
+
+	params.Req.SetPathString(params.Uri)
+
+	var msg coap.Message
+
+	if params.Id != "" {
+		msg, err = _requestDTLS(params, 0)
+	} else {
+		msg, err = _request(params)
+	}
+
+	return msg.Payload, err
+}
@@ -0,0 +1,174 @@
+package gocoap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	gocoap "github.com/moroen/gocoap/v5"
+)
+
+const (
+	testIdent = "test"
+	testKey   = "secret"
+)
+
+// testGateway starts a loopback gateway with the resources of the parity tests
+func testGateway(t *testing.T) *gocoap.CoapServer {
+	t.Helper()
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.LocalAddr().(*net.UDPAddr).Port
+	l.Close()
+
+	s := &gocoap.CoapServer{Host: "127.0.0.1", Port: port, Ident: testIdent, Key: testKey}
+	s.Handle("/15001", gocoap.GET, func(gocoap.ServerRequest) ([]byte, error) {
+		return []byte(`[65537]`), nil
+	})
+	s.Handle("/15001/65537", gocoap.GET, func(gocoap.ServerRequest) ([]byte, error) {
+		return []byte(`{"9001":"Lamp"}`), nil
+	})
+	s.Handle("/15001/65537", gocoap.PUT, func(gocoap.ServerRequest) ([]byte, error) {
+		return nil, nil
+	})
+	s.Handle("/15004", gocoap.POST, func(gocoap.ServerRequest) ([]byte, error) {
+		return []byte(`{"9003":131073}`), nil
+	})
+	s.Handle("/15011/9031", gocoap.PUT, func(gocoap.ServerRequest) ([]byte, error) {
+		return nil, gocoap.BadRequest
+	})
+	s.Handle("/15011/15012", gocoap.GET, func(gocoap.ServerRequest) ([]byte, error) {
+		return nil, gocoap.Unauthorized
+	})
+	s.Observable("/15001/65538", []byte(`{"5850":0}`))
+
+	go s.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	t.Cleanup(func() {
+		CloseDTLSConnection()
+		gocoap.CloseDTLSConnection()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s
+}
+
+func TestRequestParity(t *testing.T) {
+	s := testGateway(t)
+
+	tests := []struct {
+		name    string
+		method  gocoap.RequestMethod
+		uri     string
+		payload string
+		want    []byte
+		wantV3  []byte
+		err     error
+	}{
+		{name: "get", method: gocoap.GET, uri: "15001", want: []byte(`[65537]`)},
+		{name: "get device", method: gocoap.GET, uri: "15001/65537", want: []byte(`{"9001":"Lamp"}`)},
+		// v3 answers 2.04 Changed with the resource, it requests it again
+		{name: "put", method: gocoap.PUT, uri: "15001/65537", payload: `{"3311":[{"5850":1}]}`, wantV3: []byte(`{"9001":"Lamp"}`)},
+		{name: "post", method: gocoap.POST, uri: "15004", payload: `{"9001":"Group"}`, want: []byte(`{"9003":131073}`)},
+		{name: "not found", method: gocoap.GET, uri: "15001/1", err: UriNotFound},
+		{name: "method not allowed", method: gocoap.GET, uri: "15004", err: MethodNotAllowed},
+		{name: "bad request", method: gocoap.PUT, uri: "15011/9031", payload: "{", err: BadRequest},
+		{name: "unauthorized", method: gocoap.GET, uri: "15011/15012", err: Unauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v3 := RequestParams{Host: s.Host, Port: s.Port, Uri: tt.uri, Id: testIdent, Key: testKey, Payload: tt.payload}
+			v5 := gocoap.RequestParams{Host: s.Host, Port: s.Port, Uri: tt.uri, Id: testIdent, Key: testKey, Payload: tt.payload}
+
+			var got, gotV5 []byte
+			var err, errV5 error
+			switch tt.method {
+			case gocoap.GET:
+				got, err = GetRequest(v3)
+				gotV5, errV5 = gocoap.GetRequest(v5)
+			case gocoap.PUT:
+				got, err = PutRequest(v3)
+				gotV5, errV5 = gocoap.PutRequest(v5)
+			case gocoap.POST:
+				got, err = PostRequest(v3)
+				gotV5, errV5 = gocoap.PostRequest(v5)
+			}
+
+			wantV3 := tt.want
+			if tt.wantV3 != nil {
+				wantV3 = tt.wantV3
+			}
+			if !errors.Is(err, tt.err) || !bytes.Equal(got, wantV3) {
+				t.Errorf("v3: got %q, %v, want %q, %v", got, err, wantV3, tt.err)
+			}
+			if !errors.Is(errV5, tt.err) || !bytes.Equal(gotV5, tt.want) {
+				t.Errorf("v5: got %q, %v, want %q, %v", gotV5, errV5, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestObserveParity(t *testing.T) {
+	s := testGateway(t)
+
+	returnMsg := make(chan []byte)
+	stop := make(chan bool)
+	status := make(chan error, 1)
+
+	err := Observe(ObserveParams{Host: s.Host, Port: s.Port, URI: []string{"15001/65538"}, ID: testIdent, Key: testKey}, returnMsg, stop, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notifications, err := gocoap.ObserveChan(ctx, gocoap.ObserveParams{
+		Host: s.Host, Port: s.Port, Uri: []string{"15001/65538"}, Id: testIdent, Key: testKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receive := func(want string) {
+		t.Helper()
+
+		select {
+		case got := <-returnMsg:
+			if string(got) != want {
+				t.Errorf("v3: got %q, want %q", got, want)
+			}
+		case err := <-status:
+			t.Fatalf("v3: %v", err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("v3: no notification %q", want)
+		}
+
+		select {
+		case got := <-notifications:
+			if string(got.Payload) != want || got.Err != nil {
+				t.Errorf("v5: got %q, %v, want %q", got.Payload, got.Err, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("v5: no notification %q", want)
+		}
+	}
+
+	receive(`{"5850":0}`)
+	s.Observable("/15001/65538", nil).Set([]byte(`{"5850":1}`))
+	receive(`{"5850":1}`)
+
+	stop <- true
+	for range returnMsg {
+	}
+}
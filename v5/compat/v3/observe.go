@@ -0,0 +1,73 @@
+package gocoap
+
+import (
+	"context"
+
+	gocoap "github.com/moroen/gocoap/v5"
+	"github.com/moroen/gocoap/v5/compat/v3/coap"
+)
+
+type ObserveParams struct {
+	Host            string
+	Port            int
+	URI             []string
+	ID              string
+	Key             string
+	Req             coap.Message
+	RetryConnection bool
+}
+
+// Observe observes all params.URI and sends the payloads of their notifications to returnMsg. Errors are
+// sent to status. When stop receives a value the observations are cancelled and returnMsg is closed
+func Observe(params ObserveParams, returnMsg chan []byte, stop chan bool, status chan error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	notifications, err := gocoap.ObserveChan(ctx, gocoap.ObserveParams{
+		Host:            params.Host,
+		Port:            params.Port,
+		Uri:             params.URI,
+		Id:              params.ID,
+		Key:             params.Key,
+		RetryConnection: params.RetryConnection,
+		Backpressure:    gocoap.DropOldest,
+	})
+	if err != nil {
+		cancel()
+		return ErrorHandshake
+	}
+
+	go func(returnMsg chan []byte, stop chan bool, status chan error) {
+		defer close(returnMsg)
+		defer cancel()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case notification, ok := <-notifications:
+				if !ok {
+					return
+				}
+				if notification.Stale {
+					continue
+				}
+
+				if notification.Err != nil {
+					select {
+					case status <- notification.Err:
+					case <-stop:
+						return
+					}
+					continue
+				}
+
+				select {
+				case returnMsg <- notification.Payload:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}(returnMsg, stop, status)
+	return nil
+}
@@ -1,25 +1,27 @@
 package gocoap
 
 import (
-	"bytes"
 	"context"
-	"fmt"
+	"errors"
+	"net"
+	"strconv"
 	"sync"
 	"time"
 
 	piondtls "github.com/pion/dtls/v2"
-	"github.com/plgd-dev/go-coap/v2/dtls"
 	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _retryLimit uint = 3
 var _retryDelay = 1
 
-var _cancel func()
-var _ctx context.Context
-
 type CoapDTLSConnection struct {
 	mu                 sync.Mutex
 	Host               string
@@ -31,9 +33,38 @@ type CoapDTLSConnection struct {
 	OnDisconnect       func()
 	OnCanceled         func()
 	OnConnectionFailed func()
+	OnNotification     func(Notification, error)
+	Metrics            Metrics
+	TracerProvider     trace.TracerProvider
+	RateLimit          *RateLimit
+	Cache              *ResponseCache
+	CoalesceGets       bool
+	SubscriptionBuffer int
+	Backpressure       Backpressure
+	SessionStore       piondtls.SessionStore
+	Keepalive          *Keepalive
+	Transmission       *Transmission
+	Interceptors       []Interceptor
+	Debug              *Debug
+	DrainOnClose       bool
 	_connection        *client.ClientConn
+	localAddr          net.Addr
 	_status            int
+	cancel             context.CancelFunc
 	queue              []CoapDTLSRequest
+	limiterOnce        sync.Once
+	limiter            *limiter
+	gets               coalescer
+	subsMu             sync.Mutex
+	subscriptions      map[string]*sharedObservation
+	handshakes         handshakeCounter
+	stateMu            sync.Mutex
+	disconnectReason   error
+	rtt                rttEstimator
+	closed             bool
+	inflight           int
+	idle               chan struct{}
+	onConnect          []func()
 }
 
 type CoapDTLSRequest struct {
@@ -41,31 +72,89 @@ type CoapDTLSRequest struct {
 	Uri           string
 	Payload       string
 	Handler       func([]byte, error)
+	spanContext   trace.SpanContext
+	retries       int
+}
+
+type CoapDTLSObservation struct {
+	mu          sync.Mutex
+	handlerMu   sync.Mutex
+	Uri         string
+	observation *client.Observation
+	cancel      func(ctx context.Context) error
+	sequence    uint32
+	received    time.Time
+	timer       *time.Timer
+	generation  int
+	cancelled   bool
 }
 
 func (c *CoapDTLSConnection) Connect() error {
-	if c._status > 0 {
-		return nil
+	c.stateMu.Lock()
+	status, closed := c._status, c.closed
+	var connectCtx context.Context
+	if status == StateDisconnected && !closed {
+		c._status = StateConnecting
+		connectCtx, c.cancel = context.WithCancel(context.Background())
 	}
+	c.stateMu.Unlock()
 
-	c._status = 1 // Connecting
+	if status > 0 {
+		return nil
+	}
+	if closed {
+		return ErrorConnectionClosed
+	}
+	c.metrics().ConnectionState(c.addr(), StateConnecting)
 
-	_ctx, _cancel = context.WithCancel(context.Background())
+	ctx, span := c.tracer().Start(connectCtx, "CoapDTLSConnection.Connect", trace.WithAttributes(
+		attribute.String("net.peer.name", c.addr()),
+	))
+	defer span.End()
 
 	ticker := time.NewTicker(time.Duration(5) * time.Second)
-	for {
-		if conn, err := dtls.Dial(fmt.Sprintf("%s:%d", c.Host, c.Port), &piondtls.Config{
-			PSK: func(hint []byte) ([]byte, error) {
-				// fmt.Printf("Server's hint: %s \n", hint)
-				return []byte(c.Key), nil
-			},
-			PSKIdentityHint: []byte(c.Ident),
-			CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
-		}); err == nil {
+	for attempt := 1; ; attempt++ {
+		_, handshake := c.tracer().Start(ctx, "DTLS handshake", trace.WithAttributes(
+			attribute.Int("dtls.attempt", attempt),
+		))
+		config := dtlsConfig(c.Ident, c.Key)
+		c.Debug.configure(config)
+		var tracker *sessionTracker
+		if c.SessionStore != nil {
+			tracker = &sessionTracker{SessionStore: c.SessionStore}
+			config.SessionStore = tracker
+		}
+		conn, local, err := dialDTLS(c.addr(), config, c.Transmission.dialOptions(c.rtt.current(c.Transmission))...)
+		if err == nil {
+			resumed := tracker.resumed()
+			c.handshakes.record(resumed)
+			handshake.SetAttributes(attribute.Bool("dtls.resumed", resumed))
+		}
+		endRequestSpan(handshake, 0, 0, err)
+		c.metrics().ConnectAttempt(c.addr(), err)
+		if err == nil {
+			c.stateMu.Lock()
+			if c.closed {
+				c._status = StateDisconnected
+				c.stateMu.Unlock()
+				conn.Close()
+				c.metrics().ConnectionState(c.addr(), StateDisconnected)
+				span.SetStatus(otelcodes.Error, ErrorConnectionClosed.Error())
+				return ErrorConnectionClosed
+			}
 			c._connection = conn
-			if c.OnConnect != nil {
-				c._status = 2
-				c.OnConnect()
+			c.localAddr = local
+			c._status = StateConnected
+			onConnect, hooks := c.OnConnect, c.onConnect
+			c.stateMu.Unlock()
+			c.metrics().ConnectionState(c.addr(), StateConnected)
+
+			c.watch(conn)
+			if onConnect != nil {
+				onConnect()
+			}
+			for _, hook := range hooks {
+				hook()
 			}
 
 			if c.UseQueue {
@@ -75,32 +164,125 @@ func (c *CoapDTLSConnection) Connect() error {
 			return nil
 		} else {
 			if c.OnConnectionFailed != nil {
-				c._status = 1
+				c.setStatus(StateConnecting)
 				c.OnConnectionFailed()
 			}
 		}
 		select {
 		case <-ticker.C:
 			break
-		case <-_ctx.Done():
+		case <-connectCtx.Done():
 			if c.OnCanceled != nil {
 				c.OnCanceled()
 			}
+			span.SetStatus(otelcodes.Error, ConnectionContextCanceled.Error())
 			return ConnectionContextCanceled
 		}
 	}
 }
 
 func (c *CoapDTLSConnection) Disconnect() error {
-	_cancel()
-	if c._status == 2 {
-		c._connection.Close()
-	}
-	c._status = 0
+	c.drop(nil)
 	return nil
 }
 
+// drop cancels a connect in progress and disconnects the session with reason
+func (c *CoapDTLSConnection) drop(reason error) {
+	c.stateMu.Lock()
+	cancel := c.cancel
+	c.stateMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+
+	if !c.disconnect(c.session(), reason) {
+		c.setStatus(StateDisconnected)
+	}
+}
+
+// AddOnConnect registers f to be called after every connect, after OnConnect. Unlike setting OnConnect,
+// it is safe while the connection is in use
+func (c *CoapDTLSConnection) AddOnConnect(f func()) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	c.onConnect = append(c.onConnect, f)
+}
+
+// HandshakeStats returns the number of full and resumed DTLS handshakes of the connection
+func (c *CoapDTLSConnection) HandshakeStats() HandshakeStats {
+	return c.handshakes.stats()
+}
+
+func (c *CoapDTLSConnection) addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+func (c *CoapDTLSConnection) metrics() Metrics {
+	if c.Metrics != nil {
+		return c.Metrics
+	}
+	return _metrics
+}
+
+func (c *CoapDTLSConnection) tracer() trace.Tracer {
+	return getTracer(c.TracerProvider)
+}
+
+// capture writes msg to the pcap of Debug
+func (c *CoapDTLSConnection) capture(msg *pool.Message, out bool, t time.Time) {
+	if c.Debug == nil {
+		return
+	}
+
+	c.stateMu.Lock()
+	conn, local := c._connection, c.localAddr
+	c.stateMu.Unlock()
+
+	if conn != nil {
+		c.Debug.capture(local, conn.RemoteAddr(), msg, out, t)
+	}
+}
+
+func (c *CoapDTLSConnection) interceptors() []Interceptor {
+	if c.Interceptors != nil {
+		return c.Interceptors
+	}
+	return getInterceptors()
+}
+
+func (c *CoapDTLSConnection) setStatus(status int) {
+	c.stateMu.Lock()
+	c._status = status
+	c.stateMu.Unlock()
+	c.metrics().ConnectionState(c.addr(), status)
+}
+
+// status returns the state of the connection
+func (c *CoapDTLSConnection) status() int {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c._status
+}
+
+// session returns the DTLS session of the connection, it is nil before the first connect
+func (c *CoapDTLSConnection) session() *client.ClientConn {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c._connection
+}
+
 func (c *CoapDTLSConnection) HandleError(request CoapDTLSRequest) {
+	c.handleError(request, nil)
+}
+
+// handleError queues request and reconnects, the connection is disconnected with reason when it is connected
+func (c *CoapDTLSConnection) handleError(request CoapDTLSRequest, reason error) {
+	if c.isClosed() {
+		request.Handler([]byte{}, ErrorConnectionClosed)
+		return
+	}
+
 	if c.UseQueue {
 		log.WithFields(log.Fields{
 			"Uri": request.Uri,
@@ -109,58 +291,319 @@ func (c *CoapDTLSConnection) HandleError(request CoapDTLSRequest) {
 
 	c.AddToQueue(request)
 
-	if c._status == 2 {
-		c.Disconnect()
+	if c.status() == 2 {
+		c.metrics().Reconnect(c.addr())
+		c.drop(reason)
 	}
 	c.Connect()
 }
 
 func (c *CoapDTLSConnection) GET(ctx context.Context, uri string, handler func([]byte, error)) {
+	if !c.begin() {
+		handler([]byte{}, ErrorConnectionClosed)
+		return
+	}
+	defer c.end()
+
+	c.get(ctx, uri, handler)
+}
+
+func (c *CoapDTLSConnection) get(ctx context.Context, uri string, handler func([]byte, error)) {
 	log.WithFields(log.Fields{
 		"Uri": uri,
 	}).Debug("CoapDTLSConnection.GET")
 
-	if c._status != 2 {
+	ctx, span := startRequestSpan(ctx, c.tracer(), c.addr(), GET, uri, 0)
+	request := CoapDTLSRequest{RequestMethod: "GET", Uri: uri, Handler: handler, spanContext: span.SpanContext(), retries: retriesFromContext(ctx)}
+
+	if c.status() != 2 {
 		log.WithFields(log.Fields{
 			"Error": "Not connected",
 		}).Error("COAP - GET")
-		c.HandleError(CoapDTLSRequest{RequestMethod: "GET", Uri: uri, Handler: handler})
+		endRequestSpan(span, 0, 0, ErrorNotConnected)
+		c.HandleError(request)
 		return
 	}
 
-	if response, err := c._connection.Get(ctx, uri); err == nil {
-		if m, err := response.ReadBody(); err == nil {
-			handler(m, _processMessage(response))
+	cached, fresh, opts := c.Cache.get(uri, noAccept)
+	if fresh {
+		endRequestSpan(span, cached.Code, len(cached.Payload), nil)
+		handler(cached.Payload, nil)
+		return
+	}
+
+	if c.CoalesceGets {
+		call, leader := c.gets.join(uri)
+		if leader {
+			defer c.gets.leave(uri, call)
+			handler = c.gets.wrap(uri, call, handler)
 		} else {
-			handler([]byte{}, err)
+			select {
+			case <-call.done:
+				if m, err, ok := call.result(); ok {
+					span.SetAttributes(attribute.Bool("coap.coalesced", true))
+					endRequestSpan(span, 0, 0, err)
+					handler(m, err)
+					return
+				}
+			case <-ctx.Done():
+				endRequestSpan(span, 0, 0, ctx.Err())
+				handler([]byte{}, ctx.Err())
+				return
+			}
+		}
+	}
+
+	req := NewRequest(GET, uri)
+	req.Options = opts
+	response, err := c.invoke(ctx, req)
+	if err == nil {
+		if cached, ok := c.Cache.valid(uri, noAccept, response); ok {
+			endRequestSpan(span, response.Code, len(cached.Payload), nil)
+			handler(cached.Payload, nil)
+			return
+		}
+		if response.Code == codes.Valid && len(opts) > 0 {
+			// The entry was invalidated while it was revalidated, 2.03 has no payload to return
+			response, err = c.invoke(ctx, NewRequest(GET, uri))
 		}
+	}
+	if err == nil {
+		err = processCode(response.Code)
+		if err == nil {
+			c.Cache.store(uri, noAccept, response)
+		}
+		endRequestSpan(span, response.Code, len(response.Payload), err)
+		handler(response.Payload, err)
 	} else {
 		log.WithFields(log.Fields{
 			"Error": err.Error(),
 		}).Error("Coap - GET")
-		c.HandleError(CoapDTLSRequest{RequestMethod: "GET", Uri: uri, Handler: handler})
-
+		endRequestSpan(span, 0, 0, err)
+		if isTransportError(err) {
+			c.handleError(request, err)
+		} else {
+			handler([]byte{}, err)
+		}
 	}
 }
 
 func (c *CoapDTLSConnection) PUT(ctx context.Context, uri string, payload string, handler func([]byte, error)) {
-	if response, err := c._connection.Put(ctx, uri, message.AppJSON, bytes.NewReader([]byte(payload))); err == nil {
-		if m, err := response.ReadBody(); err == nil {
-			handler(m, _processMessage(response))
-		} else {
-			handler([]byte{}, err)
+	if !c.begin() {
+		handler([]byte{}, ErrorConnectionClosed)
+		return
+	}
+	defer c.end()
+
+	ctx, span := startRequestSpan(ctx, c.tracer(), c.addr(), PUT, uri, len(payload))
+
+	req := NewRequest(PUT, uri).WithContentFormat(message.AppJSON).WithPayload([]byte(payload))
+	response, err := c.invoke(ctx, req)
+	if err == nil {
+		err = processCode(response.Code)
+		if err == nil {
+			c.Cache.Invalidate(uri)
 		}
+		endRequestSpan(span, response.Code, len(response.Payload), err)
+		handler(response.Payload, err)
 	} else {
+		endRequestSpan(span, 0, 0, err)
 		log.WithFields(log.Fields{
 			"Error": err.Error(),
 		}).Error("Coap - PUT")
 	}
 }
 
+func (c *CoapDTLSConnection) POST(ctx context.Context, uri string, payload string, handler func([]byte, error)) {
+	c.Do(ctx, POST, uri, message.AppJSON, []byte(payload), func(response CoapResponse, err error) {
+		handler(response.Payload, err)
+	})
+}
+
+func (c *CoapDTLSConnection) DELETE(ctx context.Context, uri string, handler func([]byte, error)) {
+	c.Do(ctx, DELETE, uri, message.AppJSON, nil, func(response CoapResponse, err error) {
+		handler(response.Payload, err)
+	})
+}
+
+// Do sends a request with any method and passes the complete response to handler. Unlike GET, failed
+// requests are not queued
+func (c *CoapDTLSConnection) Do(ctx context.Context, method RequestMethod, uri string, contentFormat message.MediaType, payload []byte, handler func(CoapResponse, error)) {
+	req := NewRequest(method, uri)
+	if method == PUT || method == POST {
+		req.WithContentFormat(contentFormat).WithPayload(payload)
+	}
+	c.Send(ctx, req, handler)
+}
+
+// Send sends req and passes the complete response to handler. Like Do, failed requests are not queued
+func (c *CoapDTLSConnection) Send(ctx context.Context, req *Request, handler func(CoapResponse, error)) {
+	if !c.begin() {
+		handler(CoapResponse{}, ErrorConnectionClosed)
+		return
+	}
+	defer c.end()
+
+	uri := req.uri()
+
+	log.WithFields(log.Fields{
+		"Method": req.Method.String(),
+		"Uri":    uri,
+	}).Debug("CoapDTLSConnection.Send")
+
+	ctx, span := startRequestSpan(ctx, c.tracer(), c.addr(), req.Method, uri, len(req.Payload))
+
+	if err := req.Validate(); err != nil {
+		endRequestSpan(span, 0, 0, err)
+		handler(CoapResponse{}, err)
+		return
+	}
+
+	if c.status() != 2 {
+		endRequestSpan(span, 0, 0, ErrorNotConnected)
+		handler(CoapResponse{}, ErrorNotConnected)
+		return
+	}
+
+	cacheable := req.cacheable()
+	var validators []message.Option
+	if cacheable {
+		cached, fresh, opts := c.Cache.get(uri, req.accept())
+		if fresh {
+			endRequestSpan(span, cached.Code, len(cached.Payload), nil)
+			handler(cached, nil)
+			return
+		}
+		validators = opts
+	}
+
+	plain := req
+	if len(validators) > 0 {
+		conditional := *req
+		conditional.Options = append(append([]message.Option{}, req.Options...), validators...)
+		req = &conditional
+	}
+
+	response, err := c.invoke(ctx, req)
+	if err == nil && cacheable {
+		if cached, ok := c.Cache.valid(uri, req.accept(), response); ok {
+			endRequestSpan(span, response.Code, len(cached.Payload), nil)
+			handler(cached, nil)
+			return
+		}
+		if response.Code == codes.Valid && len(validators) > 0 {
+			// The entry was invalidated while it was revalidated, 2.03 has no payload to return
+			req = plain
+			response, err = c.invoke(ctx, req)
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": req.Method.String(),
+			"Error":  err.Error(),
+		}).Error("Coap - Send")
+		endRequestSpan(span, 0, 0, err)
+		handler(CoapResponse{}, err)
+		return
+	}
+
+	err = processCode(response.Code)
+	if err == nil {
+		if cacheable {
+			c.Cache.store(uri, req.accept(), response)
+		} else if req.Method != GET {
+			c.Cache.Invalidate(req.Path)
+		}
+	}
+	endRequestSpan(span, response.Code, len(response.Payload), err)
+	handler(response, err)
+}
+
+// invoke passes req through the interceptors of the connection to send
+func (c *CoapDTLSConnection) invoke(ctx context.Context, req *Request) (CoapResponse, error) {
+	return chain(c.interceptors(), c.send)(ctx, req)
+}
+
+// transportError marks an error of the DTLS session, only these errors queue a GET and reconnect
+type transportError struct {
+	err error
+}
+
+func (e transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e transportError) Unwrap() error {
+	return e.err
+}
+
+// TransportError marks err as a failure of the DTLS session, for the scripted errors of FakeClient
+func TransportError(err error) error {
+	return transportError{err}
+}
+
+func isTransportError(err error) bool {
+	var transport transportError
+	return errors.As(err, &transport)
+}
+
+// send sends req to the gateway, it is the last Invoker of the interceptor chain
+func (c *CoapDTLSConnection) send(ctx context.Context, req *Request) (CoapResponse, error) {
+	msg, err := req.message(ctx)
+	if err != nil {
+		return CoapResponse{}, err
+	}
+	defer pool.ReleaseMessage(msg)
+
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return CoapResponse{}, err
+	}
+
+	conn := c.session()
+	if conn == nil {
+		release()
+		return CoapResponse{}, transportError{ErrorNotConnected}
+	}
+
+	start := time.Now()
+	response, err := conn.Do(msg)
+	release()
+	recordRequest(c.metrics(), c.addr(), req.Method, start, response, err)
+	c.sampleRTT(conn, start, err)
+	c.capture(msg, true, start)
+	if err != nil {
+		return CoapResponse{}, transportError{err}
+	}
+	c.capture(response, false, time.Now())
+
+	return newCoapResponse(response)
+}
+
+// Observe registers an observation of uri. handler is called with the payload of every notification until
+// the observation is cancelled. Unlike ObserveNotifications there are no stale notifications
+func (c *CoapDTLSConnection) Observe(ctx context.Context, uri string, handler func([]byte, error)) (*CoapDTLSObservation, error) {
+	return c.observe(ctx, uri, false, func(notification Notification, err error) {
+		handler(notification.Payload, err)
+	})
+}
+
+// Cancel deregisters the observation from the server
+func (o *CoapDTLSObservation) Cancel(ctx context.Context) error {
+	o.stop()
+	if o.cancel != nil {
+		return o.cancel(ctx)
+	}
+	return o.observation.Cancel(ctx)
+}
+
 func (c *CoapDTLSConnection) AddToQueue(request CoapDTLSRequest) {
 	c.mu.Lock()
 	c.queue = append(c.queue, request)
+	length := len(c.queue)
 	c.mu.Unlock()
+
+	c.metrics().QueueLength(c.addr(), length)
 }
 
 func (c *CoapDTLSConnection) QueueLenght() int {
@@ -171,20 +614,42 @@ func (c *CoapDTLSConnection) QueueLenght() int {
 }
 
 func (c *CoapDTLSConnection) HandleQueue() {
-	defer c.mu.Unlock()
-
 	log.WithFields(log.Fields{
-		"Items": len(c.queue),
+		"Items": c.QueueLenght(),
 	}).Debug("Tradfri: HandleQueue")
 
-	var item CoapDTLSRequest
-	c.mu.Lock()
-	for len(c.queue) > 0 {
-		item, c.queue = c.queue[0], c.queue[1:]
+	for {
+		// The queue is not locked while an item is sent, a failing request is queued again by HandleError
+		c.mu.Lock()
+		if len(c.queue) == 0 {
+			c.mu.Unlock()
+			return
+		}
+		item := c.queue[0]
+		c.queue = c.queue[1:]
+		length := len(c.queue)
+		c.mu.Unlock()
+		c.metrics().QueueLength(c.addr(), length)
+
+		if !c.begin() {
+			item.Handler([]byte{}, ErrorConnectionClosed)
+			continue
+		}
+
 		switch item.RequestMethod {
 		case "GET":
-			ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
-			c.GET(ctx, item.Uri, item.Handler)
+			ctx, cancel := context.WithTimeout(withRetries(context.Background(), item.retries+1), c.requestTimeout(2*time.Second))
+			ctx, span := c.tracer().Start(ctx, "CoapDTLSConnection.HandleQueue",
+				trace.WithLinks(trace.Link{SpanContext: item.spanContext}),
+				trace.WithAttributes(
+					attribute.String("coap.uri", item.Uri),
+					attribute.Int("coap.retries", item.retries+1),
+				),
+			)
+			c.get(ctx, item.Uri, item.Handler)
+			span.End()
+			cancel()
 		}
+		c.end()
 	}
 }
@@ -1,12 +1,14 @@
 package gocoap
 
 import (
+	"net"
+
 	piondtls "github.com/pion/dtls/v2"
-	"github.com/plgd-dev/go-coap/v2/dtls"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
 )
 
 var _connection *client.ClientConn
+var _localAddr net.Addr
 var _retries uint
 var _retries_limit int
 
@@ -18,21 +20,30 @@ func getDTLSConnection(param RequestParams) (*client.ClientConn, error) {
 
 	// log.Println("Creating new connection")
 
-	co, err := dtls.Dial(param.getHost(), &piondtls.Config{
-		PSK: func(hint []byte) ([]byte, error) {
-			// fmt.Printf("Server's hint: %s \n", hint)
-			return []byte(param.Key), nil
-		},
-		PSKIdentityHint: []byte(param.Id),
-		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
-	})
+	config := dtlsConfig(param.Id, param.Key)
+	param.Debug.configure(config)
+
+	co, local, err := dialDTLS(param.getHost(), config, param.Transmission.dialOptions(param.Transmission.ackTimeout())...)
+	_metrics.ConnectAttempt(param.getHost(), err)
 	if err != nil {
 		err = ErrorHandshake
 	}
 	_connection = co
+	_localAddr = local
 	return co, err
 }
 
+func dtlsConfig(ident, key string) *piondtls.Config {
+	return &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			// fmt.Printf("Server's hint: %s \n", hint)
+			return []byte(key), nil
+		},
+		PSKIdentityHint: []byte(ident),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+}
+
 // CloseDTLSConnection closes the connection
 func CloseDTLSConnection() error {
 	if _connection != nil {
@@ -0,0 +1,77 @@
+package gocoap
+
+import (
+	"io"
+	"net"
+	"time"
+
+	piondtls "github.com/pion/dtls/v2"
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// Debug enables the debug output of DTLS connections, it exposes the traffic to anyone with the output and
+// must only be used for debugging.
+//
+// KeyLog receives the master secrets of the DTLS sessions in NSS key log format. Wireshark decrypts a
+// capture of the connection, made with tcpdump or Wireshark itself, when the file is set as
+// (Pre)-Master-Secret log filename in the TLS protocol preferences.
+//
+// Pcap receives the decrypted CoAP messages of the requests and notifications, no capture or key log is
+// needed to read it. Messages are written as sent and received by the client: retransmissions, empty
+// acknowledgements, pings and observe registrations are not included. The port of the gateway is written
+// as 5683, so Wireshark decodes the messages as CoAP instead of DTLS
+type Debug struct {
+	KeyLog io.Writer
+	Pcap   *PcapWriter
+}
+
+func (d *Debug) configure(config *piondtls.Config) {
+	if d != nil && d.KeyLog != nil {
+		config.KeyLogWriter = d.KeyLog
+	}
+}
+
+// capture writes msg to Pcap, out is set for messages from local to remote
+func (d *Debug) capture(local, remote net.Addr, msg *pool.Message, out bool, t time.Time) {
+	if d == nil || d.Pcap == nil || msg == nil {
+		return
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		return
+	}
+
+	src, dst := udpAddr(local), udpAddr(remote)
+	dst.Port = DefaultPort
+	if !out {
+		src, dst = dst, src
+	}
+	d.Pcap.WritePacket(t, src, dst, data)
+}
+
+func udpAddr(addr net.Addr) *net.UDPAddr {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return &net.UDPAddr{IP: udp.IP, Port: udp.Port, Zone: udp.Zone}
+	}
+	return &net.UDPAddr{IP: net.IPv4zero}
+}
+
+// dialDTLS dials addr like dtls.Dial and also returns the local address of the connection
+func dialDTLS(addr string, config *piondtls.Config, opts ...dtls.DialOption) (*client.ClientConn, net.Addr, error) {
+	dialer := &net.Dialer{Timeout: 3 * time.Second}
+	c, err := dialer.Dial("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := piondtls.Client(c, config)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+
+	return dtls.Client(conn, append(opts, dtls.WithCloseSocket())...), c.LocalAddr(), nil
+}
@@ -0,0 +1,297 @@
+package gocoap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// All-CoAP-Nodes multicast groups (RFC 7252 section 12.8)
+const (
+	AllCoapNodesIPv4          = "224.0.1.187"
+	AllCoapNodesIPv6LinkLocal = "ff02::fd"
+	AllCoapNodesIPv6SiteLocal = "ff05::fd"
+)
+
+const wellKnownCore = "/.well-known/core"
+
+// DiscoverParams controls where and for how long Discover listens for responses.
+// Groups defaults to the All-CoAP-Nodes groups, Interfaces to every multicast capable interface that is up
+type DiscoverParams struct {
+	Port       int
+	Interfaces []string
+	Groups     []string
+	Timeout    time.Duration
+}
+
+// DiscoveredDevice is a responder to a discovery request with the links it advertises
+type DiscoveredDevice struct {
+	Addr  *net.UDPAddr
+	Links []Link
+}
+
+func (p DiscoverParams) getGroups() []string {
+	if len(p.Groups) > 0 {
+		return p.Groups
+	}
+	return []string{AllCoapNodesIPv4, AllCoapNodesIPv6LinkLocal, AllCoapNodesIPv6SiteLocal}
+}
+
+func (p DiscoverParams) getInterfaces() ([]net.Interface, error) {
+	if len(p.Interfaces) > 0 {
+		var ifaces []net.Interface
+		for _, name := range p.Interfaces {
+			ifi, err := net.InterfaceByName(name)
+			if err != nil {
+				return nil, err
+			}
+			ifaces = append(ifaces, *ifi)
+		}
+		return ifaces, nil
+	}
+
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ifaces []net.Interface
+	for _, ifi := range all {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 {
+			ifaces = append(ifaces, ifi)
+		}
+	}
+	if len(ifaces) == 0 {
+		return nil, ErrorNoInterfaces
+	}
+	return ifaces, nil
+}
+
+// Discover sends a non-confirmable GET /.well-known/core to the All-CoAP-Nodes groups and returns every device that responds before the timeout or ctx is done
+func Discover(ctx context.Context, params DiscoverParams) ([]DiscoveredDevice, error) {
+	if params.Port == 0 {
+		params.Port = 5683
+	}
+
+	if params.Timeout == 0 {
+		params.Timeout = 2 * time.Second
+	}
+
+	ifaces, err := params.getInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := message.GetToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newDiscoverRequest(token)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, params.Timeout)
+	defer cancel()
+
+	conns := make(map[string]*net.UDPConn)
+	for _, network := range []string{"udp4", "udp6"} {
+		conn, err := net.ListenUDP(network, nil)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Network": network,
+				"Error":   err.Error(),
+			}).Debug("Discover: Unable to listen")
+			continue
+		}
+		defer conn.Close()
+		conns[network] = conn
+	}
+
+	sent := 0
+	for _, group := range params.getGroups() {
+		ip := net.ParseIP(group)
+		if ip == nil {
+			return nil, ErrorBadAddress
+		}
+
+		network := "udp6"
+		if ip.To4() != nil {
+			network = "udp4"
+		}
+
+		conn, ok := conns[network]
+		if !ok {
+			continue
+		}
+
+		if err := sendDiscover(conn, req, ip, params.Port, ifaces); err == nil {
+			sent++
+		}
+	}
+
+	if sent == 0 {
+		return nil, ErrorNoInterfaces
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	devices := make(map[string]*DiscoveredDevice)
+	var order []string
+
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer wg.Done()
+			readDiscoverResponses(conn, token, func(dev DiscoveredDevice) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				key := dev.Addr.String()
+				if d, ok := devices[key]; ok {
+					// A device answering on several groups sends its links again
+					d.Links = mergeLinks(d.Links, dev.Links)
+					return
+				}
+				devices[key] = &dev
+				order = append(order, key)
+			})
+		}(conn)
+	}
+
+	<-ctx.Done()
+	for _, conn := range conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	wg.Wait()
+
+	result := make([]DiscoveredDevice, 0, len(order))
+	for _, key := range order {
+		result = append(result, *devices[key])
+	}
+	return result, nil
+}
+
+func newDiscoverRequest(token message.Token) ([]byte, error) {
+	buf := make([]byte, 64)
+	opts, _, err := message.Options{}.SetPath(buf, wellKnownCore)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := udpMessage.Message{
+		Code:      codes.GET,
+		Token:     token,
+		MessageID: udpMessage.GetMID(),
+		Type:      udpMessage.NonConfirmable,
+		Options:   opts,
+	}
+	return msg.Marshal()
+}
+
+func sendDiscover(conn *net.UDPConn, req []byte, ip net.IP, port int, ifaces []net.Interface) error {
+	dst := &net.UDPAddr{IP: ip, Port: port}
+
+	if !ip.IsMulticast() {
+		_, err := conn.WriteToUDP(req, dst)
+		return err
+	}
+
+	var lastErr error = ErrorNoInterfaces
+	sent := false
+
+	for i := range ifaces {
+		ifi := &ifaces[i]
+		var err error
+		if ip.To4() != nil {
+			p := ipv4.NewPacketConn(conn)
+			if err = p.SetMulticastInterface(ifi); err == nil {
+				p.SetMulticastLoopback(true)
+				_, err = p.WriteTo(req, nil, dst)
+			}
+		} else {
+			p := ipv6.NewPacketConn(conn)
+			if err = p.SetMulticastInterface(ifi); err == nil {
+				p.SetMulticastLoopback(true)
+				_, err = p.WriteTo(req, nil, &net.UDPAddr{IP: ip, Port: port, Zone: ifi.Name})
+			}
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Interface": ifi.Name,
+				"Group":     ip.String(),
+				"Error":     err.Error(),
+			}).Debug("Discover: Unable to send")
+			lastErr = err
+			continue
+		}
+		sent = true
+	}
+
+	if sent {
+		return nil
+	}
+	return lastErr
+}
+
+func readDiscoverResponses(conn *net.UDPConn, token message.Token, handler func(DiscoveredDevice)) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() && !ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		msg := udpMessage.Message{Options: make(message.Options, 0, 16)}
+		if _, err := msg.Unmarshal(buf[:n]); err != nil {
+			continue
+		}
+
+		if string(msg.Token) != string(token) || msg.Code != codes.Content {
+			continue
+		}
+
+		links, err := ParseLinkFormat(msg.Payload)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Addr":  addr.String(),
+				"Error": err.Error(),
+			}).Debug("Discover: Bad link-format")
+		}
+
+		handler(DiscoveredDevice{
+			Addr:  addr,
+			Links: links,
+		})
+	}
+}
+
+// mergeLinks appends the links of more with a target not in links
+func mergeLinks(links, more []Link) []Link {
+	for _, link := range more {
+		found := false
+		for _, l := range links {
+			if l.Target == link.Target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			links = append(links, link)
+		}
+	}
+	return links
+}
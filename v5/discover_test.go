@@ -0,0 +1,128 @@
+package gocoap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// loopbackInterface returns the name of the loopback interface
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback != 0 && ifi.Flags&net.FlagUp != 0 {
+			return ifi.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler ServerHandler
+		groups  []string
+		want    []string
+	}{
+		{
+			name: "links",
+			handler: func(ServerRequest) ([]byte, error) {
+				return []byte(`</15001>;ct=50,</15004>;obs`), nil
+			},
+			want: []string{"/15001", "/15004"},
+		},
+		{
+			name: "several groups",
+			handler: func(ServerRequest) ([]byte, error) {
+				return []byte(`</15001>;ct=50,</15004>;obs`), nil
+			},
+			groups: []string{"127.0.0.1", "127.0.0.1"},
+			want:   []string{"/15001", "/15004"},
+		},
+		{
+			name: "bad link-format",
+			handler: func(ServerRequest) ([]byte, error) {
+				return []byte(`/15001`), nil
+			},
+			want: []string{},
+		},
+		{
+			name: "error response",
+			handler: func(ServerRequest) ([]byte, error) {
+				return nil, UriNotFound
+			},
+		},
+	}
+
+	iface := loopbackInterface(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Plain UDP, Discover does not use DTLS
+			s := &CoapServer{Host: "127.0.0.1", Port: testPort(t)}
+			s.Handle(wellKnownCore, GET, tt.handler)
+			go s.ListenAndServe()
+			time.Sleep(200 * time.Millisecond)
+			defer s.Shutdown(context.Background())
+
+			groups := tt.groups
+			if groups == nil {
+				groups = []string{"127.0.0.1"}
+			}
+
+			devices, err := Discover(context.Background(), DiscoverParams{
+				Port:       s.Port,
+				Interfaces: []string{iface},
+				Groups:     groups,
+				Timeout:    500 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want == nil {
+				if len(devices) != 0 {
+					t.Fatalf("got %d devices, want none", len(devices))
+				}
+				return
+			}
+			if len(devices) != 1 {
+				t.Fatalf("got %d devices, want 1", len(devices))
+			}
+
+			device := devices[0]
+			if !device.Addr.IP.Equal(net.ParseIP("127.0.0.1")) || device.Addr.Port != s.Port {
+				t.Errorf("got address %v, want 127.0.0.1:%d", device.Addr, s.Port)
+			}
+			var targets []string
+			for _, link := range device.Links {
+				targets = append(targets, link.Target)
+			}
+			if len(targets) != len(tt.want) {
+				t.Fatalf("got links %v, want %v", targets, tt.want)
+			}
+			for i := range targets {
+				if targets[i] != tt.want[i] {
+					t.Errorf("got links %v, want %v", targets, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoverBadGroup(t *testing.T) {
+	_, err := Discover(context.Background(), DiscoverParams{
+		Interfaces: []string{loopbackInterface(t)},
+		Groups:     []string{"coap.local"},
+	})
+	if err != ErrorBadAddress {
+		t.Errorf("got %v, want %v", err, ErrorBadAddress)
+	}
+}
@@ -0,0 +1,612 @@
+package gocoap
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// DNS-SD service types for CoAP (RFC 7252 section 12.10)
+const (
+	CoapService  = "_coap._udp"
+	CoapsService = "_coaps._udp"
+)
+
+var mdnsGroupIPv4 = &net.UDPAddr{IP: net.ParseIP("224.0.0.251"), Port: 5353}
+var mdnsGroupIPv6 = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: 5353}
+
+// BrowseParams controls which services are browsed for and on which interfaces.
+// Services defaults to both _coap._udp and _coaps._udp in the local. domain
+type BrowseParams struct {
+	Services   []string
+	Domain     string
+	Interfaces []string
+	Timeout    time.Duration
+	Interval   time.Duration
+}
+
+// ServiceEntry is a resolved DNS-SD service instance. Zone is the interface the link-local addresses of
+// AddrIPv6 were received on
+type ServiceEntry struct {
+	Instance string
+	Service  string
+	Domain   string
+	HostName string
+	AddrIPv4 []net.IP
+	AddrIPv6 []net.IP
+	Zone     string
+	Port     int
+	Text     map[string]string
+	TTL      time.Duration
+
+	expires time.Time
+}
+
+type ServiceEventType int
+
+const (
+	ServiceAdded ServiceEventType = iota + 1
+	ServiceRemoved
+)
+
+// ServiceEvent is reported by Watch when a service instance appears or disappears
+type ServiceEvent struct {
+	Type  ServiceEventType
+	Entry ServiceEntry
+}
+
+func (t ServiceEventType) String() string {
+	switch t {
+	case ServiceAdded:
+		return "Added"
+	case ServiceRemoved:
+		return "Removed"
+	}
+	return "Unknown"
+}
+
+func (p BrowseParams) getServices() []string {
+	if len(p.Services) > 0 {
+		return p.Services
+	}
+	return []string{CoapService, CoapsService}
+}
+
+func (p BrowseParams) getDomain() string {
+	if p.Domain == "" {
+		return "local."
+	}
+	return fqdn(p.Domain)
+}
+
+// Connection returns a CoapDTLSConnection for a _coaps._udp service instance. Ident and Key must be set by the
+// caller before connecting. Other services return ErrorNotSecure, CoapDTLSConnection always uses DTLS
+func (e ServiceEntry) Connection() (*CoapDTLSConnection, error) {
+	if !strings.EqualFold(e.Service, CoapsService) {
+		return nil, ErrorNotSecure
+	}
+
+	return &CoapDTLSConnection{
+		Host: e.Addr(),
+		Port: e.Port,
+	}, nil
+}
+
+// Addr returns the preferred address of the service instance, falling back to the host name. Link-local IPv6
+// addresses include the Zone
+func (e ServiceEntry) Addr() string {
+	if len(e.AddrIPv4) > 0 {
+		return e.AddrIPv4[0].String()
+	}
+	if len(e.AddrIPv6) > 0 {
+		if ip := e.AddrIPv6[0]; ip.IsLinkLocalUnicast() && e.Zone != "" {
+			return ip.String() + "%" + e.Zone
+		}
+		return e.AddrIPv6[0].String()
+	}
+	return strings.TrimSuffix(e.HostName, ".")
+}
+
+// Complete reports whether the entry has been resolved to an address and port
+func (e ServiceEntry) Complete() bool {
+	return e.Port != 0 && (len(e.AddrIPv4) > 0 || len(e.AddrIPv6) > 0)
+}
+
+// Browse queries mDNS for CoAP services and returns the instances resolved before the timeout or ctx is done
+func Browse(ctx context.Context, params BrowseParams) ([]ServiceEntry, error) {
+	if params.Timeout == 0 {
+		params.Timeout = 3 * time.Second
+	}
+
+	r, err := newMdnsResolver(params)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	ctx, cancel := context.WithTimeout(ctx, params.Timeout)
+	defer cancel()
+
+	r.run(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []ServiceEntry
+	for _, key := range r.order {
+		if entry, ok := r.entries[key]; ok && entry.Complete() {
+			result = append(result, *entry)
+		}
+	}
+	return result, nil
+}
+
+// Time after a query before instances whose records were not refreshed by the answers are removed
+const watchExpireDelay = 3 * time.Second
+
+// Watch browses continuously, re-querying every Interval, and calls handler when an instance is resolved or
+// when it sends a goodbye or its records expire. Goodbyes are multicast, they are only received when the
+// mDNS group can be joined on port 5353. Watch blocks until ctx is done
+func Watch(ctx context.Context, params BrowseParams, handler func(ServiceEvent)) error {
+	if params.Interval == 0 {
+		params.Interval = 30 * time.Second
+	}
+
+	r, err := newMdnsResolver(params)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	r.onChange = handler
+	r.listen()
+	r.start()
+	r.query()
+
+	requery := time.NewTicker(params.Interval)
+	defer requery.Stop()
+
+	resolve := time.NewTicker(200 * time.Millisecond)
+	defer resolve.Stop()
+
+	// Legacy unicast answers have a TTL of at most 10 seconds, so records are only expired after the
+	// answers to the next query had time to refresh them
+	expire := time.NewTimer(watchExpireDelay)
+	defer expire.Stop()
+
+	for {
+		select {
+		case <-resolve.C:
+			r.resolve()
+		case <-requery.C:
+			r.query()
+			expire.Reset(watchExpireDelay)
+		case now := <-expire.C:
+			r.expire(now)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type mdnsResolver struct {
+	mu        sync.Mutex
+	conns     map[string]*net.UDPConn
+	listeners []*net.UDPConn
+	ifaces    []net.Interface
+	services  map[string]string
+	entries   map[string]*ServiceEntry
+	hosts     map[string]*mdnsHost
+	order     []string
+	asked     map[string]bool
+	onChange  func(ServiceEvent)
+	wg        sync.WaitGroup
+}
+
+// mdnsHost holds the addresses of a host name until their records expire
+type mdnsHost struct {
+	ips     []net.IP
+	zone    string
+	expires time.Time
+}
+
+func newMdnsResolver(params BrowseParams) (*mdnsResolver, error) {
+	ifaces, err := DiscoverParams{Interfaces: params.Interfaces}.getInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &mdnsResolver{
+		conns:    make(map[string]*net.UDPConn),
+		ifaces:   ifaces,
+		services: make(map[string]string),
+		entries:  make(map[string]*ServiceEntry),
+		hosts:    make(map[string]*mdnsHost),
+		asked:    make(map[string]bool),
+	}
+
+	for _, service := range params.getServices() {
+		r.services[strings.ToLower(fqdn(service)+params.getDomain())] = strings.TrimSuffix(service, ".")
+	}
+
+	// Queries are sent from an ephemeral port, so responders answer with legacy unicast (RFC 6762 section 6.7)
+	for _, network := range []string{"udp4", "udp6"} {
+		conn, err := net.ListenUDP(network, nil)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Network": network,
+				"Error":   err.Error(),
+			}).Debug("mDNS: Unable to listen")
+			continue
+		}
+		r.conns[network] = conn
+	}
+
+	if len(r.conns) == 0 {
+		return nil, ErrorNoInterfaces
+	}
+
+	return r, nil
+}
+
+// listen joins the mDNS groups on port 5353 to receive the multicast goodbyes of instances
+func (r *mdnsResolver) listen() {
+	for _, group := range []*net.UDPAddr{mdnsGroupIPv4, mdnsGroupIPv6} {
+		network := "udp4"
+		if group.IP.To4() == nil {
+			network = "udp6"
+		}
+
+		conn, err := net.ListenMulticastUDP(network, nil, group)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Network": network,
+				"Error":   err.Error(),
+			}).Debug("mDNS: Unable to join group")
+			continue
+		}
+
+		for i := range r.ifaces {
+			ifi := &r.ifaces[i]
+			if network == "udp4" {
+				err = ipv4.NewPacketConn(conn).JoinGroup(ifi, group)
+			} else {
+				err = ipv6.NewPacketConn(conn).JoinGroup(ifi, group)
+			}
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Interface": ifi.Name,
+					"Network":   network,
+					"Error":     err.Error(),
+				}).Debug("mDNS: Unable to join group")
+			}
+		}
+		r.listeners = append(r.listeners, conn)
+	}
+}
+
+func (r *mdnsResolver) start() {
+	for _, conn := range r.conns {
+		r.wg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer r.wg.Done()
+			r.read(conn)
+		}(conn)
+	}
+	for _, conn := range r.listeners {
+		r.wg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer r.wg.Done()
+			r.read(conn)
+		}(conn)
+	}
+}
+
+func (r *mdnsResolver) close() {
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+	for _, conn := range r.listeners {
+		conn.Close()
+	}
+	r.wg.Wait()
+}
+
+func (r *mdnsResolver) run(ctx context.Context) {
+	r.start()
+	r.query()
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.resolve()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// query sends a PTR question for every browsed service and allows the instances to be resolved again
+func (r *mdnsResolver) query() {
+	r.mu.Lock()
+	r.asked = make(map[string]bool)
+	r.mu.Unlock()
+
+	var questions []dnsmessage.Question
+	for name := range r.services {
+		questions = appendQuestions(questions, name, dnsmessage.TypePTR)
+	}
+	r.send(questions)
+}
+
+// resolve asks for the SRV, TXT and address records of instances that are not yet complete
+func (r *mdnsResolver) resolve() {
+	r.mu.Lock()
+	var questions []dnsmessage.Question
+	for name, entry := range r.entries {
+		if entry.Port == 0 && !r.asked[name] {
+			r.asked[name] = true
+			questions = appendQuestions(questions, name, dnsmessage.TypeSRV, dnsmessage.TypeTXT)
+		}
+		if host := strings.ToLower(entry.HostName); host != "" && !entry.Complete() && !r.asked[host] {
+			r.asked[host] = true
+			questions = appendQuestions(questions, host, dnsmessage.TypeA, dnsmessage.TypeAAAA)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(questions) > 0 {
+		r.send(questions)
+	}
+}
+
+func (r *mdnsResolver) send(questions []dnsmessage.Question) {
+	msg := dnsmessage.Message{Questions: questions}
+	packet, err := msg.Pack()
+	if err != nil {
+		return
+	}
+
+	for network, conn := range r.conns {
+		var err error
+		for i := range r.ifaces {
+			ifi := &r.ifaces[i]
+			if network == "udp4" {
+				p := ipv4.NewPacketConn(conn)
+				if err = p.SetMulticastInterface(ifi); err == nil {
+					_, err = p.WriteTo(packet, nil, mdnsGroupIPv4)
+				}
+			} else {
+				p := ipv6.NewPacketConn(conn)
+				if err = p.SetMulticastInterface(ifi); err == nil {
+					_, err = p.WriteTo(packet, nil, &net.UDPAddr{IP: mdnsGroupIPv6.IP, Port: mdnsGroupIPv6.Port, Zone: ifi.Name})
+				}
+			}
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Interface": ifi.Name,
+					"Network":   network,
+					"Error":     err.Error(),
+				}).Debug("mDNS: Unable to send query")
+			}
+		}
+	}
+}
+
+func (r *mdnsResolver) read(conn *net.UDPConn) {
+	buf := make([]byte, 9000)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() && !ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil || !msg.Header.Response {
+			continue
+		}
+
+		r.handleResponse(msg, addr.Zone)
+	}
+}
+
+// handleResponse adds the records of msg, zone is the interface of the IPv6 source address
+func (r *mdnsResolver) handleResponse(msg dnsmessage.Message, zone string) {
+	records := append(append(msg.Answers, msg.Authorities...), msg.Additionals...)
+	now := time.Now()
+
+	r.mu.Lock()
+	var events []ServiceEvent
+
+	// PTR records first so that SRV/TXT records in the same packet find their instance
+	for _, rr := range records {
+		ptr, ok := rr.Body.(*dnsmessage.PTRResource)
+		if !ok {
+			continue
+		}
+		service, ok := r.services[strings.ToLower(rr.Header.Name.String())]
+		if !ok {
+			continue
+		}
+
+		instance := ptr.PTR.String()
+		key := strings.ToLower(instance)
+		ttl := time.Duration(rr.Header.TTL) * time.Second
+
+		if ttl == 0 {
+			if entry, ok := r.entries[key]; ok {
+				r.remove(key)
+				if entry.Complete() {
+					events = append(events, ServiceEvent{Type: ServiceRemoved, Entry: *entry})
+				}
+			}
+			continue
+		}
+
+		entry, ok := r.entries[key]
+		if !ok {
+			entry = &ServiceEntry{
+				Instance: strings.TrimSuffix(strings.TrimSuffix(instance, rr.Header.Name.String()), "."),
+				Service:  service,
+				Domain:   strings.TrimPrefix(strings.ToLower(rr.Header.Name.String()), strings.ToLower(fqdn(service))),
+				Text:     make(map[string]string),
+			}
+			r.entries[key] = entry
+			r.order = append(r.order, key)
+		}
+		entry.TTL = ttl
+		entry.expires = now.Add(ttl)
+	}
+
+	for _, rr := range records {
+		name := strings.ToLower(rr.Header.Name.String())
+		switch body := rr.Body.(type) {
+		case *dnsmessage.SRVResource:
+			if entry, ok := r.entries[name]; ok {
+				entry.HostName = body.Target.String()
+				entry.Port = int(body.Port)
+			}
+		case *dnsmessage.TXTResource:
+			if entry, ok := r.entries[name]; ok {
+				for _, txt := range body.TXT {
+					k, v := txt, ""
+					if i := strings.IndexByte(txt, '='); i >= 0 {
+						k, v = txt[:i], txt[i+1:]
+					}
+					entry.Text[k] = v
+				}
+			}
+		case *dnsmessage.AResource:
+			r.addHost(name, net.IP(body.A[:]), "", now.Add(time.Duration(rr.Header.TTL)*time.Second))
+		case *dnsmessage.AAAAResource:
+			r.addHost(name, net.IP(body.AAAA[:]), zone, now.Add(time.Duration(rr.Header.TTL)*time.Second))
+		}
+	}
+
+	for _, key := range r.order {
+		entry, ok := r.entries[key]
+		if !ok || entry.Complete() || entry.HostName == "" {
+			continue
+		}
+		host, ok := r.hosts[strings.ToLower(entry.HostName)]
+		if !ok {
+			continue
+		}
+		for _, ip := range host.ips {
+			if ip.To4() != nil {
+				entry.AddrIPv4 = appendIP(entry.AddrIPv4, ip)
+			} else {
+				entry.AddrIPv6 = appendIP(entry.AddrIPv6, ip)
+			}
+		}
+		if host.zone != "" {
+			entry.Zone = host.zone
+		}
+		if entry.Complete() {
+			events = append(events, ServiceEvent{Type: ServiceAdded, Entry: *entry})
+		}
+	}
+	onChange := r.onChange
+	r.mu.Unlock()
+
+	if onChange != nil {
+		for _, event := range events {
+			onChange(event)
+		}
+	}
+}
+
+// addHost adds ip to the addresses of the host name, r.mu must be held. The zone of link-local addresses is
+// the interface they were received on
+func (r *mdnsResolver) addHost(name string, ip net.IP, zone string, expires time.Time) {
+	host, ok := r.hosts[name]
+	if !ok {
+		host = &mdnsHost{}
+		r.hosts[name] = host
+	}
+	host.ips = appendIP(host.ips, ip)
+	if ip.IsLinkLocalUnicast() && zone != "" {
+		host.zone = zone
+	}
+	host.expires = expires
+}
+
+// remove deletes the entry of key, r.mu must be held
+func (r *mdnsResolver) remove(key string) {
+	delete(r.entries, key)
+	for i, k := range r.order {
+		if k == key {
+			r.order = append(r.order[:i:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// expire removes entries whose PTR record and host addresses whose records were not refreshed within
+// their TTL
+func (r *mdnsResolver) expire(now time.Time) {
+	r.mu.Lock()
+	var events []ServiceEvent
+	for _, key := range append([]string(nil), r.order...) {
+		entry := r.entries[key]
+		if entry != nil && now.After(entry.expires) {
+			r.remove(key)
+			if entry.Complete() {
+				events = append(events, ServiceEvent{Type: ServiceRemoved, Entry: *entry})
+			}
+		}
+	}
+	for name, host := range r.hosts {
+		if now.After(host.expires) {
+			delete(r.hosts, name)
+		}
+	}
+	onChange := r.onChange
+	r.mu.Unlock()
+
+	if onChange != nil {
+		for _, event := range events {
+			onChange(event)
+		}
+	}
+}
+
+func appendQuestions(questions []dnsmessage.Question, name string, types ...dnsmessage.Type) []dnsmessage.Question {
+	n, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return questions
+	}
+	for _, typ := range types {
+		questions = append(questions, dnsmessage.Question{Name: n, Type: typ, Class: dnsmessage.ClassINET})
+	}
+	return questions
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func appendIP(ips []net.IP, ip net.IP) []net.IP {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return ips
+		}
+	}
+	return append(ips, append(net.IP(nil), ip...))
+}
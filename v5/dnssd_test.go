@@ -0,0 +1,93 @@
+package gocoap
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestServiceEntryConnection(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry ServiceEntry
+		host  string
+		err   error
+	}{
+		{
+			name:  "coaps",
+			entry: ServiceEntry{Service: CoapsService, AddrIPv4: []net.IP{net.ParseIP("192.168.1.2")}, Port: 5684},
+			host:  "192.168.1.2",
+		},
+		{
+			name:  "coap",
+			entry: ServiceEntry{Service: CoapService, AddrIPv4: []net.IP{net.ParseIP("192.168.1.2")}, Port: 5683},
+			err:   ErrorNotSecure,
+		},
+		{
+			name:  "link-local",
+			entry: ServiceEntry{Service: CoapsService, AddrIPv6: []net.IP{net.ParseIP("fe80::1")}, Zone: "eth0", Port: 5684},
+			host:  "fe80::1%eth0",
+		},
+		{
+			name:  "global",
+			entry: ServiceEntry{Service: CoapsService, AddrIPv6: []net.IP{net.ParseIP("2001:db8::1")}, Zone: "eth0", Port: 5684},
+			host:  "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := tt.entry.Connection()
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if conn != nil {
+					t.Fatalf("got a connection with error %v", err)
+				}
+				return
+			}
+			if conn.Host != tt.host || conn.Port != tt.entry.Port {
+				t.Fatalf("got %s:%d, want %s:%d", conn.Host, conn.Port, tt.host, tt.entry.Port)
+			}
+		})
+	}
+}
+
+func TestHandleResponseZone(t *testing.T) {
+	service := dnsmessage.MustNewName("_coaps._udp.local.")
+	instance := dnsmessage.MustNewName("gw._coaps._udp.local.")
+	host := dnsmessage.MustNewName("gw.local.")
+	header := func(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET, TTL: 120}
+	}
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true},
+		Answers: []dnsmessage.Resource{
+			{Header: header(service, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: instance}},
+			{Header: header(instance, dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: host, Port: 5684}},
+			{Header: header(host, dnsmessage.TypeAAAA), Body: &dnsmessage.AAAAResource{AAAA: [16]byte{0xfe, 0x80, 15: 1}}},
+		},
+	}
+
+	r := &mdnsResolver{
+		services: map[string]string{"_coaps._udp.local.": CoapsService},
+		entries:  make(map[string]*ServiceEntry),
+		hosts:    make(map[string]*mdnsHost),
+		asked:    make(map[string]bool),
+	}
+	var added []ServiceEntry
+	r.onChange = func(event ServiceEvent) {
+		added = append(added, event.Entry)
+	}
+	r.handleResponse(msg, "eth0")
+
+	if len(added) != 1 {
+		t.Fatalf("got %d entries, want 1", len(added))
+	}
+	if addr := added[0].Addr(); addr != "fe80::1%eth0" {
+		t.Fatalf("got address %s, want fe80::1%%eth0", addr)
+	}
+}
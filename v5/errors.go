@@ -43,3 +43,39 @@ var ErrorNoPayload = errors.New("COAP Error: No payload for request")
 
 // ErrorConnectionContextCanceled
 var ConnectionContextCanceled = errors.New("COAP Error: Connection Context Canceled")
+
+// ErrorNoInterfaces
+var ErrorNoInterfaces = errors.New("COAP Error: No usable multicast interfaces")
+
+// ErrorBadAddress
+var ErrorBadAddress = errors.New("COAP Error: Bad address")
+
+// ErrorBadLinkFormat
+var ErrorBadLinkFormat = errors.New("COAP Error: Bad link-format")
+
+// ErrorServerRunning
+var ErrorServerRunning = errors.New("COAP Error: Server already running")
+
+// ErrorNotConnected
+var ErrorNotConnected = errors.New("COAP Error: Not connected")
+
+// ErrorStaleObservation
+var ErrorStaleObservation = errors.New("COAP Error: Observation is stale")
+
+// ErrorKeepaliveTimeout
+var ErrorKeepaliveTimeout = errors.New("COAP Error: Keepalive timeout")
+
+// ErrorConnectionLost
+var ErrorConnectionLost = errors.New("COAP Error: Connection lost")
+
+// ErrorInvalidRequest
+var ErrorInvalidRequest = errors.New("COAP Error: Invalid request")
+
+// ErrorBadURL
+var ErrorBadURL = errors.New("COAP Error: Invalid coap or coaps URL")
+
+// ErrorConnectionClosed
+var ErrorConnectionClosed = errors.New("COAP Error: Connection closed")
+
+// ErrorNotSecure
+var ErrorNotSecure = errors.New("COAP Error: Service does not use DTLS")
@@ -0,0 +1,280 @@
+package gocoap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FakeClient is an in-memory Client for tests. Responses are scripted per method and URI with Respond and
+// RespondOnce, requests without a script fail with UriNotFound like on the gateway. Every request is
+// recorded, see Calls. Handlers are called before the request method returns.
+//
+// Scripted errors wrapped with TransportError fail like a lost DTLS session on CoapDTLSConnection: a GET
+// is queued without calling its handler until HandleQueue sends it again, and the handler of a PUT is not
+// called. POST and DELETE pass the error to their handler
+//
+// Observe registers the handler for Notify and NotifyError. When a GET of the URI is scripted, the handler
+// first receives that response, like the initial notification from the gateway, and a scripted error
+// fails the observation. The zero value is a FakeClient without scripts
+type FakeClient struct {
+	mu        sync.Mutex
+	responses map[fakeKey]fakeResponse
+	once      map[fakeKey][]fakeResponse
+	calls     []FakeCall
+	queue     []fakeRequest
+	observers map[string][]*fakeObserver
+}
+
+type fakeRequest struct {
+	uri     string
+	handler func([]byte, error)
+}
+
+// FakeCall is a request received by a FakeClient. Observe is set for the GET of an observation
+type FakeCall struct {
+	Method  RequestMethod
+	Uri     string
+	Payload string
+	Observe bool
+}
+
+type fakeKey struct {
+	method RequestMethod
+	uri    string
+}
+
+type fakeResponse struct {
+	payload []byte
+	err     error
+}
+
+type fakeObserver struct {
+	observation *CoapDTLSObservation
+	handler     func([]byte, error)
+}
+
+// NewFakeClient returns a FakeClient without scripted responses
+func NewFakeClient() *FakeClient {
+	return &FakeClient{}
+}
+
+// Respond scripts the response to all requests with method for uri. Responses scripted with RespondOnce
+// are returned first
+func (f *FakeClient) Respond(method RequestMethod, uri string, payload []byte, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.responses == nil {
+		f.responses = make(map[fakeKey]fakeResponse)
+	}
+	f.responses[fakeKey{method, uri}] = fakeResponse{payload, err}
+}
+
+// RespondOnce scripts the response to the next request with method for uri. Responses scripted more than
+// once are returned in order
+func (f *FakeClient) RespondOnce(method RequestMethod, uri string, payload []byte, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.once == nil {
+		f.once = make(map[fakeKey][]fakeResponse)
+	}
+	key := fakeKey{method, uri}
+	f.once[key] = append(f.once[key], fakeResponse{payload, err})
+}
+
+// Calls returns the requests received so far, in order
+func (f *FakeClient) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// Reset removes the scripted responses, the recorded calls and the observations
+func (f *FakeClient) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses = nil
+	f.once = nil
+	f.calls = nil
+	f.queue = nil
+	f.observers = nil
+}
+
+// QueueLenght returns the number of GET requests queued after a TransportError
+func (f *FakeClient) QueueLenght() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.queue)
+}
+
+// HandleQueue sends the queued GET requests again, like CoapDTLSConnection after a reconnect. Requests
+// that fail with a TransportError again are queued again
+func (f *FakeClient) HandleQueue() {
+	f.mu.Lock()
+	queue := f.queue
+	f.queue = nil
+	f.mu.Unlock()
+
+	for _, request := range queue {
+		f.do(context.Background(), GET, request.uri, "", request.handler)
+	}
+}
+
+func (f *FakeClient) GET(ctx context.Context, uri string, handler func([]byte, error)) {
+	f.do(ctx, GET, uri, "", handler)
+}
+
+func (f *FakeClient) PUT(ctx context.Context, uri string, payload string, handler func([]byte, error)) {
+	f.do(ctx, PUT, uri, payload, handler)
+}
+
+func (f *FakeClient) POST(ctx context.Context, uri string, payload string, handler func([]byte, error)) {
+	f.do(ctx, POST, uri, payload, handler)
+}
+
+func (f *FakeClient) DELETE(ctx context.Context, uri string, handler func([]byte, error)) {
+	f.do(ctx, DELETE, uri, "", handler)
+}
+
+// Observe registers an observation of uri, see FakeClient
+func (f *FakeClient) Observe(ctx context.Context, uri string, handler func([]byte, error)) (*CoapDTLSObservation, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, FakeCall{Method: GET, Uri: uri, Observe: true})
+	response, scripted := f.response(GET, uri)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if scripted && response.err != nil {
+		return nil, response.err
+	}
+
+	observer := &fakeObserver{handler: handler}
+	observer.observation = &CoapDTLSObservation{
+		Uri: uri,
+		cancel: func(context.Context) error {
+			f.remove(uri, observer)
+			return nil
+		},
+	}
+
+	f.mu.Lock()
+	if f.observers == nil {
+		f.observers = make(map[string][]*fakeObserver)
+	}
+	f.observers[uri] = append(f.observers[uri], observer)
+	f.mu.Unlock()
+
+	if scripted {
+		observer.notify(response.payload, nil)
+	}
+	return observer.observation, nil
+}
+
+// Notify sends payload to the observers of uri and returns their number
+func (f *FakeClient) Notify(uri string, payload []byte) int {
+	return f.notify(uri, payload, nil)
+}
+
+// NotifyError sends err to the observers of uri and returns their number
+func (f *FakeClient) NotifyError(uri string, err error) int {
+	return f.notify(uri, []byte{}, err)
+}
+
+// Observers returns the number of observations of uri that are not cancelled
+func (f *FakeClient) Observers(uri string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.observers[uri])
+}
+
+func (f *FakeClient) do(ctx context.Context, method RequestMethod, uri string, payload string, handler func([]byte, error)) {
+	f.mu.Lock()
+	f.calls = append(f.calls, FakeCall{Method: method, Uri: uri, Payload: payload})
+	response, scripted := f.response(method, uri)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		handler([]byte{}, err)
+		return
+	}
+	if !scripted {
+		handler([]byte{}, UriNotFound)
+		return
+	}
+	if isTransportError(response.err) {
+		switch method {
+		case GET:
+			f.mu.Lock()
+			f.queue = append(f.queue, fakeRequest{uri, handler})
+			f.mu.Unlock()
+			return
+		case PUT:
+			return
+		}
+	}
+	if response.err != nil {
+		handler([]byte{}, response.err)
+		return
+	}
+	handler(response.payload, nil)
+}
+
+// response returns the scripted response to method for uri, f.mu must be held
+func (f *FakeClient) response(method RequestMethod, uri string) (fakeResponse, bool) {
+	key := fakeKey{method, uri}
+	if queue := f.once[key]; len(queue) > 0 {
+		f.once[key] = queue[1:]
+		return queue[0], true
+	}
+
+	response, ok := f.responses[key]
+	return response, ok
+}
+
+func (f *FakeClient) notify(uri string, payload []byte, err error) int {
+	f.mu.Lock()
+	observers := append([]*fakeObserver(nil), f.observers[uri]...)
+	f.mu.Unlock()
+
+	for _, observer := range observers {
+		observer.notify(payload, err)
+	}
+	return len(observers)
+}
+
+func (f *FakeClient) remove(uri string, observer *fakeObserver) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	observers := f.observers[uri]
+	for i, o := range observers {
+		if o == observer {
+			f.observers[uri] = append(observers[:i:i], observers[i+1:]...)
+			break
+		}
+	}
+	if len(f.observers[uri]) == 0 {
+		delete(f.observers, uri)
+	}
+}
+
+func (o *fakeObserver) notify(payload []byte, err error) {
+	o.observation.mu.Lock()
+	if o.observation.cancelled {
+		o.observation.mu.Unlock()
+		return
+	}
+	o.observation.sequence++
+	o.observation.received = time.Now()
+	o.observation.mu.Unlock()
+
+	o.handler(payload, err)
+}
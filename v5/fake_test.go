@@ -0,0 +1,220 @@
+package gocoap
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeResult records the calls of a request handler
+type fakeResult struct {
+	called  int
+	payload string
+	err     error
+}
+
+func (r *fakeResult) handler(payload []byte, err error) {
+	r.called++
+	r.payload = string(payload)
+	r.err = err
+}
+
+func TestFakeClientRespond(t *testing.T) {
+	lost := TransportError(errors.New("session lost"))
+
+	tests := []struct {
+		name   string
+		script func(f *FakeClient)
+		method RequestMethod
+		want   []fakeResponse
+	}{
+		{
+			name:   "not scripted",
+			script: func(f *FakeClient) {},
+			method: GET,
+			want:   []fakeResponse{{[]byte{}, UriNotFound}},
+		},
+		{
+			name: "respond",
+			script: func(f *FakeClient) {
+				f.Respond(GET, "/15001/65536", []byte(`{"5850":1}`), nil)
+			},
+			method: GET,
+			want:   []fakeResponse{{[]byte(`{"5850":1}`), nil}, {[]byte(`{"5850":1}`), nil}},
+		},
+		{
+			name: "respond once first",
+			script: func(f *FakeClient) {
+				f.Respond(GET, "/15001/65536", []byte(`{"5850":0}`), nil)
+				f.RespondOnce(GET, "/15001/65536", []byte(`{"5850":1}`), nil)
+				f.RespondOnce(GET, "/15001/65536", nil, BadRequest)
+			},
+			method: GET,
+			want: []fakeResponse{
+				{[]byte(`{"5850":1}`), nil},
+				{[]byte{}, BadRequest},
+				{[]byte(`{"5850":0}`), nil},
+			},
+		},
+		{
+			name: "respond once only",
+			script: func(f *FakeClient) {
+				f.RespondOnce(POST, "/15001/65536", []byte(`{"5850":1}`), nil)
+			},
+			method: POST,
+			want:   []fakeResponse{{[]byte(`{"5850":1}`), nil}, {[]byte{}, UriNotFound}},
+		},
+		{
+			name: "other method",
+			script: func(f *FakeClient) {
+				f.Respond(GET, "/15001/65536", []byte(`{"5850":1}`), nil)
+			},
+			method: DELETE,
+			want:   []fakeResponse{{[]byte{}, UriNotFound}},
+		},
+		{
+			name: "transport error",
+			script: func(f *FakeClient) {
+				f.Respond(POST, "/15001/65536", nil, lost)
+			},
+			method: POST,
+			want:   []fakeResponse{{[]byte{}, lost}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFakeClient()
+			tt.script(f)
+
+			for i, want := range tt.want {
+				var result fakeResult
+				switch tt.method {
+				case GET:
+					f.GET(context.Background(), "/15001/65536", result.handler)
+				case POST:
+					f.POST(context.Background(), "/15001/65536", `{"5850":1}`, result.handler)
+				case DELETE:
+					f.DELETE(context.Background(), "/15001/65536", result.handler)
+				}
+
+				if result.called != 1 || result.payload != string(want.payload) || !errors.Is(result.err, want.err) {
+					t.Fatalf("request %d: got %d calls with %q, %v, want %q, %v", i, result.called, result.payload, result.err, want.payload, want.err)
+				}
+			}
+
+			if calls := f.Calls(); len(calls) != len(tt.want) {
+				t.Fatalf("got %d calls, want %d", len(calls), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestFakeClientQueue(t *testing.T) {
+	f := NewFakeClient()
+	lost := TransportError(errors.New("session lost"))
+	f.RespondOnce(GET, "/15001/65536", nil, lost)
+	f.RespondOnce(GET, "/15001/65536", nil, lost)
+	f.Respond(GET, "/15001/65536", []byte(`{"5850":1}`), nil)
+	f.Respond(PUT, "/15001/65536", nil, lost)
+
+	var put fakeResult
+	f.PUT(context.Background(), "/15001/65536", `{"3311":[{"5850":1}]}`, put.handler)
+	if put.called != 0 || f.QueueLenght() != 0 {
+		t.Fatalf("PUT with transport error: got %d handler calls and %d queued, want none", put.called, f.QueueLenght())
+	}
+
+	var get fakeResult
+	f.GET(context.Background(), "/15001/65536", get.handler)
+	if get.called != 0 || f.QueueLenght() != 1 {
+		t.Fatalf("GET with transport error: got %d handler calls and %d queued, want 0 and 1", get.called, f.QueueLenght())
+	}
+
+	// The first replay fails on the transport again and is queued again
+	f.HandleQueue()
+	if get.called != 0 || f.QueueLenght() != 1 {
+		t.Fatalf("first replay: got %d handler calls and %d queued, want 0 and 1", get.called, f.QueueLenght())
+	}
+
+	f.HandleQueue()
+	if get.called != 1 || get.payload != `{"5850":1}` || get.err != nil || f.QueueLenght() != 0 {
+		t.Fatalf("second replay: got %d handler calls with %q, %v and %d queued", get.called, get.payload, get.err, f.QueueLenght())
+	}
+
+	f.Reset()
+	f.RespondOnce(GET, "/15001/65536", nil, lost)
+	f.GET(context.Background(), "/15001/65536", get.handler)
+	f.Reset()
+	if f.QueueLenght() != 0 {
+		t.Fatalf("got %d queued after Reset, want none", f.QueueLenght())
+	}
+}
+
+func TestFakeClientObserveCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancel returns the observations the handler of the first observer cancels
+		cancel    func(first, second *CoapDTLSObservation) []*CoapDTLSObservation
+		want      [2]int
+		observers int
+	}{
+		{
+			name:      "self",
+			cancel:    func(first, second *CoapDTLSObservation) []*CoapDTLSObservation { return []*CoapDTLSObservation{first} },
+			want:      [2]int{1, 2},
+			observers: 1,
+		},
+		{
+			name:      "other",
+			cancel:    func(first, second *CoapDTLSObservation) []*CoapDTLSObservation { return []*CoapDTLSObservation{second} },
+			want:      [2]int{2, 0},
+			observers: 1,
+		},
+		{
+			name: "both",
+			cancel: func(first, second *CoapDTLSObservation) []*CoapDTLSObservation {
+				return []*CoapDTLSObservation{first, second}
+			},
+			want: [2]int{1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFakeClient()
+			var calls [2]int
+			var first, second *CoapDTLSObservation
+			var err error
+
+			first, err = f.Observe(context.Background(), "/15001/65536", func([]byte, error) {
+				calls[0]++
+				if calls[0] == 1 {
+					for _, obs := range tt.cancel(first, second) {
+						if err := obs.Cancel(context.Background()); err != nil {
+							t.Error(err)
+						}
+					}
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err = f.Observe(context.Background(), "/15001/65536", func([]byte, error) {
+				calls[1]++
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f.Notify("/15001/65536", []byte(`{"5850":1}`))
+			f.Notify("/15001/65536", []byte(`{"5850":0}`))
+
+			if calls != tt.want {
+				t.Fatalf("got %v handler calls, want %v", calls, tt.want)
+			}
+			if got := f.Observers("/15001/65536"); got != tt.observers {
+				t.Fatalf("got %d observers, want %d", got, tt.observers)
+			}
+		})
+	}
+}
@@ -1,11 +1,7 @@
 package gocoap
 
 import (
-	"bytes"
-	"context"
-	"log"
-
-	"time"
+	"strings"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -16,7 +12,11 @@ import (
 )
 
 func _processMessage(resp *pool.Message) error {
-	switch resp.Code() {
+	return processCode(resp.Code())
+}
+
+func processCode(code codes.Code) error {
+	switch code {
 	case codes.Content:
 		return nil
 	case codes.MethodNotAllowed:
@@ -27,6 +27,10 @@ func _processMessage(resp *pool.Message) error {
 		return nil
 	case codes.Created:
 		return nil
+	case codes.Deleted:
+		return nil
+	case codes.Valid:
+		return nil
 	case codes.BadRequest:
 		return BadRequest
 	case codes.Unauthorized:
@@ -36,86 +40,19 @@ func _processMessage(resp *pool.Message) error {
 	return ErrorUnknownError
 }
 
+// _request sends the request of params with SendRequest, over DTLS when Id is set and plain UDP otherwise
 func _request(params RequestParams) (retmsg []byte, err error) {
-	/*
-		conn, err := coap.Dial("udp", fmt.Sprintf("%s:%d", params.Host, params.Port))
-		if err != nil {
-			return retmsg, err
-		}
-
-		resp, err := conn.Send(params.Req)
-		if err != nil {
-			return retmsg, err
-		}
-
-		err = _processMessage(*resp)
-
-		return *resp, err
-	*/
-	return nil, nil
-}
-
-func _requestDTLS(params RequestParams) (retmsg []byte, err error) {
-
-	co, err := getDTLSConnection(params)
-	if err != nil {
-		return nil, err
-	}
-
-	path := params.Uri
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
-	if params.Method == GET {
-		resp, err := co.Get(ctx, path)
-		if err != nil {
-			log.Fatalf("Error sending request: %v", err)
-		}
-
-		m, err := resp.ReadBody()
-		if err != nil {
-			return nil, err
-		}
-
-		err = _processMessage(resp)
-		// log.Printf("Response: %+v\nBody: %s\n", resp, m)
-		return m, err
+	parts := strings.SplitN(params.Uri, "?", 2)
+	req := NewRequest(params.Method, parts[0])
+	if len(parts) == 2 && parts[1] != "" {
+		req.Query = strings.Split(parts[1], "&")
 	}
-
-	if params.Method == PUT {
-		payload := bytes.NewReader([]byte(params.Payload))
-
-		resp, err := co.Put(ctx, path, message.AppJSON, payload)
-		if err != nil {
-			log.Fatal(err.Error())
-		}
-
-		m, err := resp.ReadBody()
-		if err != nil {
-			return nil, err
-		}
-
-		return m, _processMessage(resp)
+	if params.Method == PUT || params.Method == POST {
+		req.WithContentFormat(message.AppJSON).WithPayload([]byte(params.Payload))
 	}
 
-	if params.Method == POST {
-		payload := bytes.NewReader([]byte(params.Payload))
-
-		resp, err := co.Post(ctx, params.Uri, message.AppJSON, payload)
-		if err != nil {
-			return nil, err
-		}
-
-		m, err := resp.ReadBody()
-		if err != nil {
-			return nil, err
-		}
-
-		return m, _processMessage(resp)
-	}
-
-	return nil, nil
+	response, err := SendRequest(params, req)
+	return response.Payload, err
 }
 
 // GetRequest sends a default get
@@ -124,11 +61,7 @@ func GetRequest(params RequestParams) (response []byte, err error) {
 
 	params.Method = GET
 
-	if params.Id != "" {
-		msg, err = _requestDTLS(params)
-	} else {
-		msg, err = _request(params)
-	}
+	msg, err = _request(params)
 
 	return msg, err
 }
@@ -143,11 +76,7 @@ func PutRequest(params RequestParams) (response []byte, err error) {
 
 	params.Method = PUT
 
-	if params.Id != "" {
-		msg, err = _requestDTLS(params)
-	} else {
-		msg, err = _request(params)
-	}
+	msg, err = _request(params)
 
 	return msg, err
 }
@@ -162,11 +91,7 @@ func PostRequest(params RequestParams) (response []byte, err error) {
 
 	params.Method = POST
 
-	if params.Id != "" {
-		msg, err = _requestDTLS(params)
-	} else {
-		msg, err = _request(params)
-	}
+	msg, err = _request(params)
 
 	return msg, err
 }
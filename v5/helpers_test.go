@@ -0,0 +1,55 @@
+package gocoap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// testPort returns a free UDP port on the loopback interface
+func testPort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.LocalAddr().(*net.UDPAddr).Port
+}
+
+// testServer starts s on a free port and shuts it down at the end of the test
+func testServer(t *testing.T, s *CoapServer) {
+	t.Helper()
+
+	s.Host = "127.0.0.1"
+	s.Port = testPort(t)
+	s.Ident = "test"
+	s.Key = "secret"
+	go s.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+}
+
+// testConnection connects to s and closes the connection at the end of the test
+func testConnection(t *testing.T, s *CoapServer, interceptors ...Interceptor) *CoapDTLSConnection {
+	t.Helper()
+
+	conn := &CoapDTLSConnection{Host: s.Host, Port: s.Port, Ident: s.Ident, Key: s.Key, Interceptors: interceptors}
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		conn.Close(ctx)
+	})
+	return conn
+}
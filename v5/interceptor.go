@@ -0,0 +1,55 @@
+package gocoap
+
+import (
+	"context"
+	"sync"
+)
+
+// Invoker sends req and returns the response
+type Invoker func(ctx context.Context, req *Request) (CoapResponse, error)
+
+// Interceptor is called for every request of a connection or of the package request functions. It may
+// modify req before passing it to next, return a response without calling next, or inspect the response
+// and error next returns. Changes to req are sent as they are, without validation:
+//
+//	func audit(ctx context.Context, req *gocoap.Request, next gocoap.Invoker) (gocoap.CoapResponse, error) {
+//		response, err := next(ctx, req)
+//		log.Printf("%s %s: %s %v", req.Method, req.Path, response.Code, err)
+//		return response, err
+//	}
+//
+// The first interceptor is the outermost, it sees the request first and the response last. Responses
+// returned without calling next are handled as responses from the gateway and are cached. Errors are passed
+// to the handler of the request, only a GET failing with a TransportError, as next returns when the exchange
+// failed, is queued for retry
+type Interceptor func(ctx context.Context, req *Request, next Invoker) (CoapResponse, error)
+
+var _interceptorsMu sync.RWMutex
+var _interceptors []Interceptor
+
+// SetInterceptors sets the interceptors of the package request functions and of connections without
+// their own Interceptors
+func SetInterceptors(interceptors ...Interceptor) {
+	_interceptorsMu.Lock()
+	defer _interceptorsMu.Unlock()
+
+	_interceptors = interceptors
+}
+
+func getInterceptors() []Interceptor {
+	_interceptorsMu.RLock()
+	defer _interceptorsMu.RUnlock()
+
+	return _interceptors
+}
+
+// chain returns an Invoker that passes requests through interceptors to invoker
+func chain(interceptors []Interceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, req *Request) (CoapResponse, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return invoker
+}
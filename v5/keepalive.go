@@ -0,0 +1,129 @@
+package gocoap
+
+import (
+	"context"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	log "github.com/sirupsen/logrus"
+)
+
+// Keepalive configures the liveness check of a CoapDTLSConnection. Every Interval a CoAP ping, an empty
+// confirmable message, is sent to the gateway, or a GET of Uri if it is set. When MaxMissed pings in a
+// row get no response within Timeout the connection is lost: it is closed and OnDisconnect is called with
+// DisconnectReason ErrorKeepaliveTimeout. Reconnect makes the connection reconnect after it was lost
+type Keepalive struct {
+	Interval  time.Duration
+	Timeout   time.Duration
+	MaxMissed int
+	Uri       string
+	Reconnect bool
+}
+
+// DisconnectReason returns why the connection was last disconnected. It is nil after Disconnect,
+// ErrorKeepaliveTimeout when the gateway stopped responding, ErrorConnectionLost when the DTLS session
+// was closed by the gateway or failed, and the TransportError of a GET that failed on the transport
+func (c *CoapDTLSConnection) DisconnectReason() error {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.disconnectReason
+}
+
+// watch detects the loss of conn, by its close event and by the keepalive pings
+func (c *CoapDTLSConnection) watch(conn *client.ClientConn) {
+	conn.AddOnClose(func() {
+		c.lost(conn, ErrorConnectionLost)
+	})
+
+	if c.Keepalive != nil && c.Keepalive.Interval > 0 {
+		go c.keepalive(conn, *c.Keepalive)
+	}
+}
+
+func (c *CoapDTLSConnection) keepalive(conn *client.ClientConn, config Keepalive) {
+	if config.Timeout <= 0 {
+		config.Timeout = config.Interval
+	}
+	if config.MaxMissed <= 0 {
+		config.MaxMissed = 1
+	}
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-conn.Context().Done():
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(conn.Context(), config.Timeout)
+		err := ping(ctx, conn, config.Uri)
+		cancel()
+
+		if err == nil {
+			missed = 0
+			continue
+		}
+
+		missed++
+		log.WithFields(log.Fields{
+			"Host":   c.addr(),
+			"Missed": missed,
+			"Error":  err.Error(),
+		}).Debug("CoapDTLSConnection.Keepalive")
+
+		if missed >= config.MaxMissed {
+			c.lost(conn, ErrorKeepaliveTimeout)
+			return
+		}
+	}
+}
+
+func ping(ctx context.Context, conn *client.ClientConn, uri string) error {
+	if uri == "" {
+		return conn.Ping(ctx)
+	}
+	_, err := conn.Get(ctx, uri)
+	return err
+}
+
+// lost disconnects the connection if conn is still its current session
+func (c *CoapDTLSConnection) lost(conn *client.ClientConn, reason error) {
+	if !c.disconnect(conn, reason) {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"Host":   c.addr(),
+		"Reason": reason.Error(),
+	}).Error("CoapDTLSConnection: Connection lost")
+
+	if c.Keepalive != nil && c.Keepalive.Reconnect {
+		c.metrics().Reconnect(c.addr())
+		go c.Connect()
+	}
+}
+
+// disconnect closes conn and calls OnDisconnect. It reports false when conn is not the connected session,
+// because it was already disconnected
+func (c *CoapDTLSConnection) disconnect(conn *client.ClientConn, reason error) bool {
+	c.stateMu.Lock()
+	if c._status != StateConnected || c._connection != conn {
+		c.stateMu.Unlock()
+		return false
+	}
+	c.disconnectReason = reason
+	c._status = StateDisconnected
+	c.stateMu.Unlock()
+	c.metrics().ConnectionState(c.addr(), StateDisconnected)
+
+	conn.Close()
+
+	if c.OnDisconnect != nil {
+		c.OnDisconnect()
+	}
+	return true
+}
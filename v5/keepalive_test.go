@@ -0,0 +1,39 @@
+package gocoap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDisconnectReasonTransport(t *testing.T) {
+	s := &CoapServer{}
+	var calls int32
+	s.Handle("/15001/65536", GET, func(ServerRequest) ([]byte, error) {
+		// Only the first request times out, the queued retry gets the response
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		return []byte(`{"5850":1}`), nil
+	})
+	testServer(t, s)
+
+	conn := testConnection(t, s)
+	conn.UseQueue = true
+
+	handler, results := testHandler()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	conn.GET(ctx, "/15001/65536", handler)
+
+	if result := waitResult(t, results); result.err != nil || result.payload != `{"5850":1}` {
+		t.Fatalf("got %q, %v, want the response of the retry", result.payload, result.err)
+	}
+
+	reason := conn.DisconnectReason()
+	if !isTransportError(reason) || !errors.Is(reason, context.DeadlineExceeded) {
+		t.Fatalf("got DisconnectReason %v, want the transport error of the GET", reason)
+	}
+}
@@ -0,0 +1,73 @@
+package gocoap
+
+import (
+	"strings"
+)
+
+// Link is a single entry of a CoRE Link Format (RFC 6690) document
+type Link struct {
+	Target     string
+	Attributes map[string]string
+}
+
+// ParseLinkFormat parses an application/link-format payload as returned from /.well-known/core
+func ParseLinkFormat(data []byte) ([]Link, error) {
+	var links []Link
+
+	for _, entry := range splitUnquoted(string(data), ',') {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := splitUnquoted(entry, ';')
+
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			return nil, ErrorBadLinkFormat
+		}
+
+		link := Link{
+			Target:     target[1 : len(target)-1],
+			Attributes: make(map[string]string),
+		}
+
+		for _, attr := range parts[1:] {
+			attr = strings.TrimSpace(attr)
+			if attr == "" {
+				continue
+			}
+			name, value := attr, ""
+			if i := strings.IndexByte(attr, '='); i >= 0 {
+				name, value = attr[:i], strings.Trim(attr[i+1:], "\"")
+			}
+			link.Attributes[name] = value
+		}
+
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// splitUnquoted splits s at every sep that is not inside a quoted string or <uri-reference>
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	var quoted, bracketed bool
+
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == '<' && !quoted:
+			bracketed = true
+		case c == '>' && !quoted:
+			bracketed = false
+		case c == sep && !quoted && !bracketed:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
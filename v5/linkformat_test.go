@@ -0,0 +1,69 @@
+package gocoap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseLinkFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Link
+		err  error
+	}{
+		{name: "empty"},
+		{
+			name: "target",
+			data: "</15001>",
+			want: []Link{{Target: "/15001", Attributes: map[string]string{}}},
+		},
+		{
+			name: "attributes",
+			data: `</sensors/temp>;rt="temperature-c";if=sensor;obs`,
+			want: []Link{{Target: "/sensors/temp", Attributes: map[string]string{"rt": "temperature-c", "if": "sensor", "obs": ""}}},
+		},
+		{
+			name: "links",
+			data: "</15001>;ct=50,\n</15004>;ct=50, </15011/15012>",
+			want: []Link{
+				{Target: "/15001", Attributes: map[string]string{"ct": "50"}},
+				{Target: "/15004", Attributes: map[string]string{"ct": "50"}},
+				{Target: "/15011/15012", Attributes: map[string]string{}},
+			},
+		},
+		{
+			name: "quoted separators",
+			data: `</a>;title="x, y; z",</b>`,
+			want: []Link{
+				{Target: "/a", Attributes: map[string]string{"title": "x, y; z"}},
+				{Target: "/b", Attributes: map[string]string{}},
+			},
+		},
+		{
+			name: "separators in target",
+			data: "<coap://host/a,b;c>;rt=x",
+			want: []Link{{Target: "coap://host/a,b;c", Attributes: map[string]string{"rt": "x"}}},
+		},
+		{
+			name: "empty entries",
+			data: ",</a>;;,",
+			want: []Link{{Target: "/a", Attributes: map[string]string{}}},
+		},
+		{name: "no brackets", data: "/15001;ct=50", err: ErrorBadLinkFormat},
+		{name: "unterminated target", data: "</15001;ct=50", err: ErrorBadLinkFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLinkFormat([]byte(tt.data))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package gocoap
+
+import (
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// Connection states reported to Metrics.ConnectionState
+const (
+	StateDisconnected = 0
+	StateConnecting   = 1
+	StateConnected    = 2
+)
+
+// Metrics receives instrumentation events from CoapDTLSConnection and the package-level request
+// functions. host is the gateway address in host:port form. code is 0 when no response was received
+type Metrics interface {
+	ConnectAttempt(host string, err error)
+	ConnectionState(host string, state int)
+	Reconnect(host string)
+	QueueLength(host string, length int)
+	Request(host string, method RequestMethod, code codes.Code, duration time.Duration, err error)
+	ObserveNotification(host string, uri string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ConnectAttempt(string, error)                                    {}
+func (nopMetrics) ConnectionState(string, int)                                     {}
+func (nopMetrics) Reconnect(string)                                                {}
+func (nopMetrics) QueueLength(string, int)                                         {}
+func (nopMetrics) Request(string, RequestMethod, codes.Code, time.Duration, error) {}
+func (nopMetrics) ObserveNotification(string, string)                              {}
+
+var _metrics Metrics = nopMetrics{}
+
+// SetMetrics sets the Metrics used by the package-level request functions and by connections without their own Metrics
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	_metrics = m
+}
+
+func recordRequest(m Metrics, host string, method RequestMethod, start time.Time, response *pool.Message, err error) {
+	var code codes.Code
+	if err == nil && response != nil {
+		code = response.Code()
+	}
+	m.Request(host, method, code, time.Since(start), err)
+}
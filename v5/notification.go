@@ -0,0 +1,190 @@
+package gocoap
+
+import (
+	"context"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	log "github.com/sirupsen/logrus"
+)
+
+// Notification is a notification of the observed resource Uri. Sequence is the value of the Observe option and
+// Received the time the notification arrived, MaxAge is 0 without Max-Age option. Stale is set on the
+// notification passed to the handler of ObserveNotifications when MaxAge has passed without a newer
+// notification, it repeats the last payload. Err is only used by ObserveChan
+type Notification struct {
+	Uri      string
+	Payload  []byte
+	Sequence uint32
+	Received time.Time
+	MaxAge   time.Duration
+	Stale    bool
+	Err      error
+}
+
+// ObserveNotifications registers an observation of uri like Observe. Notifications that arrive out of
+// order (RFC 7641 section 3.4) are dropped, and handler is called once with a Stale notification when the
+// last notification is older than its Max-Age. Notifications without Max-Age option or with a Max-Age of
+// 0 don't go stale. OnNotification of the connection is called before handler for every notification,
+// handler is not called concurrently
+func (c *CoapDTLSConnection) ObserveNotifications(ctx context.Context, uri string, handler func(Notification, error)) (*CoapDTLSObservation, error) {
+	return c.observe(ctx, uri, true, handler)
+}
+
+// observe registers an observation of uri, stale enables the stale notifications
+func (c *CoapDTLSConnection) observe(ctx context.Context, uri string, stale bool, handler func(Notification, error)) (*CoapDTLSObservation, error) {
+	log.WithFields(log.Fields{
+		"Uri": uri,
+	}).Debug("CoapDTLSConnection.Observe")
+
+	if c.isClosed() {
+		return nil, ErrorConnectionClosed
+	}
+
+	if c.status() != 2 {
+		return nil, ErrorNotConnected
+	}
+
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	o := &CoapDTLSObservation{Uri: uri}
+	if c.OnNotification != nil {
+		next := handler
+		handler = func(notification Notification, err error) {
+			c.OnNotification(notification, err)
+			next(notification, err)
+		}
+	}
+
+	obs, err := c.session().Observe(ctx, uri, func(msg *pool.Message) {
+		c.capture(msg, false, time.Now())
+
+		o.handlerMu.Lock()
+		defer o.handlerMu.Unlock()
+
+		notification, ok := o.receive(msg)
+		if !ok {
+			log.WithFields(log.Fields{
+				"Uri":      uri,
+				"Sequence": notification.Sequence,
+			}).Debug("CoapDTLSConnection.Observe: Dropped out of order notification")
+			return
+		}
+
+		c.metrics().ObserveNotification(c.addr(), uri)
+		c.Cache.Invalidate(uri)
+
+		m, err := msg.ReadBody()
+		if err != nil {
+			handler(notification, err)
+			return
+		}
+		notification.Payload = m
+		if _, err := msg.Observe(); err == nil && stale {
+			if notification.MaxAge > 0 {
+				o.arm(notification, handler)
+			} else {
+				o.disarm()
+			}
+		}
+		handler(notification, _processMessage(msg))
+	})
+	if err != nil {
+		o.stop()
+		return nil, err
+	}
+
+	o.observation = obs
+	return o, nil
+}
+
+// receive records the sequence number and time of msg. ok is false when msg is older than the last notification
+func (o *CoapDTLSObservation) receive(msg *pool.Message) (notification Notification, ok bool) {
+	notification.Uri = o.Uri
+	notification.Received = time.Now()
+	if age, err := msg.Options().GetUint32(message.MaxAge); err == nil {
+		notification.MaxAge = time.Duration(age) * time.Second
+	}
+
+	sequence, err := msg.Observe()
+	if err != nil {
+		// Responses without Observe option end the observation and are always delivered
+		return notification, true
+	}
+	notification.Sequence = sequence
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.received.IsZero() || observation.ValidSequenceNumber(o.sequence, sequence, o.received, notification.Received) {
+		o.sequence = sequence
+		o.received = notification.Received
+		return notification, true
+	}
+	return notification, false
+}
+
+// arm restarts the timer that signals a stale observation after the Max-Age of notification
+func (o *CoapDTLSObservation) arm(notification Notification, handler func(Notification, error)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cancelled {
+		return
+	}
+
+	o.generation++
+	generation := o.generation
+
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	o.timer = time.AfterFunc(notification.MaxAge, func() {
+		o.handlerMu.Lock()
+		defer o.handlerMu.Unlock()
+
+		o.mu.Lock()
+		current := generation == o.generation && !o.cancelled
+		o.mu.Unlock()
+
+		if current {
+			stale := notification
+			stale.Stale = true
+			handler(stale, nil)
+		}
+	})
+}
+
+// disarm stops the stale timer, a notification without Max-Age does not go stale
+func (o *CoapDTLSObservation) disarm() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.generation++
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+}
+
+func (o *CoapDTLSObservation) stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.cancelled = true
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+}
+
+// LastNotification returns the sequence number and receive time of the last notification
+func (o *CoapDTLSObservation) LastNotification() (sequence uint32, received time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.sequence, o.received
+}
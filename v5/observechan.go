@@ -0,0 +1,152 @@
+package gocoap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Backpressure selects what ObserveChan does when the receiver doesn't keep up with the notifications
+type Backpressure int
+
+const (
+	// DropOldest drops the oldest buffered notification to make room for a new one
+	DropOldest Backpressure = iota
+	// Block waits until the receiver takes the notification. This stalls the connection, including
+	// responses to other requests, until the channel has room or the context is cancelled
+	Block
+)
+
+// Timeout for cancelling observations when the context of ObserveChan is done
+const observeCancelTimeout = 2 * time.Second
+
+// ObserveChan observes uris and returns a channel with their notifications. Errors are delivered
+// in-band in Notification.Err. The channel buffers SubscriptionBuffer notifications and is handled
+// according to the Backpressure of the connection when it is full. When ctx is done the observations
+// are cancelled and the channel is closed. When the DTLS session is lost a notification with
+// ErrorConnectionLost is sent for every uri and the channel is closed, the observations are not renewed
+// on reconnect: call ObserveChan again after the connection is connected
+func (c *CoapDTLSConnection) ObserveChan(ctx context.Context, uris ...string) (<-chan Notification, error) {
+	size := c.SubscriptionBuffer
+	if size <= 0 {
+		size = defaultSubscriptionBuffer
+	}
+
+	out := make(chan Notification, size)
+	var mu sync.Mutex
+	closed := false
+
+	send := func(notification Notification, err error) {
+		notification.Err = err
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if closed {
+			return
+		}
+
+		if c.Backpressure == Block {
+			select {
+			case out <- notification:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		for {
+			select {
+			case out <- notification:
+				return
+			default:
+			}
+
+			select {
+			case <-out:
+			default:
+			}
+		}
+	}
+
+	session := c.session()
+	observations := make([]*CoapDTLSObservation, 0, len(uris))
+	cancel := func() {
+		ctx, done := context.WithTimeout(context.Background(), observeCancelTimeout)
+		defer done()
+
+		for _, obs := range observations {
+			if err := obs.Cancel(ctx); err != nil {
+				log.WithFields(log.Fields{
+					"Uri":   obs.Uri,
+					"Error": err.Error(),
+				}).Debug("CoapDTLSConnection.ObserveChan: Cancel")
+			}
+		}
+	}
+
+	for _, uri := range uris {
+		obs, err := c.ObserveNotifications(ctx, uri, send)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		observations = append(observations, obs)
+	}
+	if session == nil {
+		return nil, ErrorNotConnected
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-session.Context().Done():
+			for _, uri := range uris {
+				send(Notification{Uri: uri, Received: time.Now()}, ErrorConnectionLost)
+			}
+		}
+
+		mu.Lock()
+		closed = true
+		close(out)
+		mu.Unlock()
+	}()
+
+	return out, nil
+}
+
+// ObserveChan connects to the gateway in params and observes all params.Uri, see
+// CoapDTLSConnection.ObserveChan. The connection is closed when ctx is done
+func ObserveChan(ctx context.Context, params ObserveParams) (<-chan Notification, error) {
+	conn := &CoapDTLSConnection{
+		Host:         params.Host,
+		Port:         params.Port,
+		Ident:        params.Id,
+		Key:          params.Key,
+		Backpressure: params.Backpressure,
+	}
+	if !params.RetryConnection {
+		conn.OnConnectionFailed = func() {
+			conn.Disconnect()
+		}
+	}
+
+	if err := conn.Connect(); err != nil {
+		return nil, err
+	}
+
+	notifications, err := conn.ObserveChan(ctx, params.Uri...)
+	if err != nil {
+		conn.Disconnect()
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Disconnect()
+	}()
+
+	return notifications, nil
+}
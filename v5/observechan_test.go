@@ -0,0 +1,52 @@
+package gocoap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestObserveChanLost(t *testing.T) {
+	s := &CoapServer{}
+	lamp := s.Observable("/15001/65536", []byte(`{"5850":0}`))
+	testServer(t, s)
+	conn := testConnection(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifications, err := conn.ObserveChan(ctx, "/15001/65536")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() (Notification, bool) {
+		t.Helper()
+		select {
+		case notification, ok := <-notifications:
+			return notification, ok
+		case <-time.After(2 * time.Second):
+			t.Fatal("no notification")
+			return Notification{}, false
+		}
+	}
+
+	if notification, _ := next(); notification.Err != nil || string(notification.Payload) != `{"5850":0}` {
+		t.Fatalf("got %q, %v, want the current payload", notification.Payload, notification.Err)
+	}
+	lamp.Set([]byte(`{"5850":1}`))
+	if notification, _ := next(); string(notification.Payload) != `{"5850":1}` {
+		t.Fatalf("got %q, want the new payload", notification.Payload)
+	}
+
+	// The session closes without the observations being cancelled
+	conn.session().Close()
+
+	notification, ok := next()
+	if !ok || !errors.Is(notification.Err, ErrorConnectionLost) || notification.Uri != "/15001/65536" {
+		t.Fatalf("got %+v, %v, want ErrorConnectionLost for /15001/65536", notification, ok)
+	}
+	if _, ok := next(); ok {
+		t.Fatal("channel not closed after the session was lost")
+	}
+}
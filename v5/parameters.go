@@ -1,15 +1,33 @@
 package gocoap
 
-import "fmt"
+import (
+	"net"
+	"strconv"
+)
 
 type RequestMethod int
 
 var (
-	GET  RequestMethod = 1
-	PUT  RequestMethod = 2
-	POST RequestMethod = 3
+	GET    RequestMethod = 1
+	PUT    RequestMethod = 2
+	POST   RequestMethod = 3
+	DELETE RequestMethod = 4
 )
 
+func (m RequestMethod) String() string {
+	switch m {
+	case GET:
+		return "GET"
+	case PUT:
+		return "PUT"
+	case POST:
+		return "POST"
+	case DELETE:
+		return "DELETE"
+	}
+	return "UNKNOWN"
+}
+
 type RequestParams struct {
 	Host    string
 	Port    int
@@ -18,6 +36,9 @@ type RequestParams struct {
 	Key     string
 	Payload string
 	Method  RequestMethod
+
+	Transmission *Transmission
+	Debug        *Debug
 }
 
 type ObserveParams struct {
@@ -27,8 +48,9 @@ type ObserveParams struct {
 	Id              string
 	Key             string
 	RetryConnection bool
+	Backpressure    Backpressure
 }
 
 func (r RequestParams) getHost() string {
-	return fmt.Sprintf("%s:%d", r.Host, r.Port)
+	return net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
 }
@@ -0,0 +1,139 @@
+package gocoap
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Link type of pcap files with raw IPv4 and IPv6 packets
+const pcapLinkTypeRaw = 101
+
+// PcapWriter writes UDP datagrams as packets of a pcap file, which can be opened in Wireshark or tcpdump.
+// The IP and UDP headers are generated, the file header is written with the first packet
+type PcapWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	started bool
+	err     error
+}
+
+// NewPcapWriter returns a PcapWriter that writes to w
+func NewPcapWriter(w io.Writer) *PcapWriter {
+	return &PcapWriter{w: w}
+}
+
+// Err returns the first error writing a packet
+func (p *PcapWriter) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// WritePacket writes payload as UDP datagram from src to dst, captured at t. Packets between an IPv4 and
+// an IPv6 address are written as IPv6
+func (p *PcapWriter) WritePacket(t time.Time, src, dst *net.UDPAddr, payload []byte) error {
+	packet := udpPacket(src, dst, payload)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	if !p.started {
+		header := make([]byte, 24)
+		binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+		binary.LittleEndian.PutUint16(header[4:], 2)
+		binary.LittleEndian.PutUint16(header[6:], 4)
+		binary.LittleEndian.PutUint32(header[16:], 65535)
+		binary.LittleEndian.PutUint32(header[20:], pcapLinkTypeRaw)
+		if _, p.err = p.w.Write(header); p.err != nil {
+			return p.err
+		}
+		p.started = true
+	}
+
+	record := make([]byte, 16, 16+len(packet))
+	binary.LittleEndian.PutUint32(record[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+	_, p.err = p.w.Write(append(record, packet...))
+	return p.err
+}
+
+// udpPacket returns an IP packet with the UDP datagram
+func udpPacket(src, dst *net.UDPAddr, payload []byte) []byte {
+	datagram := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(datagram[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(datagram[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(datagram[4:], uint16(len(datagram)))
+	copy(datagram[8:], payload)
+
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP != nil && dstIP != nil {
+		header := make([]byte, 20)
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:], uint16(len(header)+len(datagram)))
+		binary.BigEndian.PutUint16(header[6:], 0x4000)
+		header[8] = 64
+		header[9] = 17
+		copy(header[12:], srcIP)
+		copy(header[16:], dstIP)
+		binary.BigEndian.PutUint16(header[10:], checksum(header))
+
+		binary.BigEndian.PutUint16(datagram[6:], udpChecksum(srcIP, dstIP, datagram))
+		return append(header, datagram...)
+	}
+
+	srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	if srcIP == nil {
+		srcIP = net.IPv6unspecified
+	}
+	if dstIP == nil {
+		dstIP = net.IPv6unspecified
+	}
+	header := make([]byte, 40)
+	header[0] = 0x60
+	binary.BigEndian.PutUint16(header[4:], uint16(len(datagram)))
+	header[6] = 17
+	header[7] = 64
+	copy(header[8:], srcIP)
+	copy(header[24:], dstIP)
+
+	binary.BigEndian.PutUint16(datagram[6:], udpChecksum(srcIP, dstIP, datagram))
+	return append(header, datagram...)
+}
+
+// udpChecksum returns the checksum of datagram with the pseudo header of the IP addresses
+func udpChecksum(src, dst net.IP, datagram []byte) uint16 {
+	pseudo := make([]byte, 0, 2*len(src)+4)
+	pseudo = append(pseudo, src...)
+	pseudo = append(pseudo, dst...)
+	pseudo = append(pseudo, 0, 17, byte(len(datagram)>>8), byte(len(datagram)))
+
+	sum := checksum(append(pseudo, datagram...))
+	if sum == 0 {
+		return 0xffff
+	}
+	return sum
+}
+
+// checksum returns the internet checksum of data (RFC 1071)
+func checksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,111 @@
+// Package prometheus exposes gocoap metrics as a Prometheus collector.
+//
+//	collector := prometheus.NewCollector("gocoap")
+//	prom.MustRegister(collector)
+//	gocoap.SetMetrics(collector)
+package prometheus
+
+import (
+	"time"
+
+	gocoap "github.com/moroen/gocoap/v5"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements gocoap.Metrics and prometheus.Collector
+type Collector struct {
+	connectAttempts *prom.CounterVec
+	connectionState *prom.GaugeVec
+	reconnects      *prom.CounterVec
+	queueLength     *prom.GaugeVec
+	requests        *prom.HistogramVec
+	notifications   *prom.CounterVec
+}
+
+var _ gocoap.Metrics = (*Collector)(nil)
+
+// NewCollector creates a Collector with all metric names prefixed by namespace
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		connectAttempts: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "connect_attempts_total",
+			Help:      "DTLS connection attempts by result.",
+		}, []string{"host", "result"}),
+		connectionState: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connection_state",
+			Help:      "Connection state, 0 disconnected, 1 connecting, 2 connected.",
+		}, []string{"host"}),
+		reconnects: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconnects_total",
+			Help:      "Reconnects after a failed request.",
+		}, []string{"host"}),
+		queueLength: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_length",
+			Help:      "Requests waiting in the retry queue.",
+		}, []string{"host"}),
+		requests: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Request latency by method and response code.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"host", "method", "code"}),
+		notifications: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "observe_notifications_total",
+			Help:      "Observe notifications received.",
+		}, []string{"host", "uri"}),
+	}
+}
+
+func (c *Collector) collectors() []prom.Collector {
+	return []prom.Collector{c.connectAttempts, c.connectionState, c.reconnects, c.queueLength, c.requests, c.notifications}
+}
+
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+func (c *Collector) ConnectAttempt(host string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	c.connectAttempts.WithLabelValues(host, result).Inc()
+}
+
+func (c *Collector) ConnectionState(host string, state int) {
+	c.connectionState.WithLabelValues(host).Set(float64(state))
+}
+
+func (c *Collector) Reconnect(host string) {
+	c.reconnects.WithLabelValues(host).Inc()
+}
+
+func (c *Collector) QueueLength(host string, length int) {
+	c.queueLength.WithLabelValues(host).Set(float64(length))
+}
+
+func (c *Collector) Request(host string, method gocoap.RequestMethod, code codes.Code, duration time.Duration, err error) {
+	label := "error"
+	if code != 0 {
+		label = code.String()
+	}
+	c.requests.WithLabelValues(host, method.String(), label).Observe(duration.Seconds())
+}
+
+func (c *Collector) ObserveNotification(host string, uri string) {
+	c.notifications.WithLabelValues(host, uri).Inc()
+}
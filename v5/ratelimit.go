@@ -0,0 +1,114 @@
+package gocoap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the requests a CoapDTLSConnection sends to the gateway. NStart is the maximum number
+// of outstanding exchanges (RFC 7252 section 4.7, default 1). Rate and Burst configure a token bucket
+// in requests per second, the request equivalent of PROBING_RATE; a Rate of 0 disables the bucket.
+// Requests over the limit wait until they may be sent or their context is done
+type RateLimit struct {
+	NStart int
+	Rate   float64
+	Burst  int
+}
+
+type limiter struct {
+	slots  chan struct{}
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(config RateLimit) *limiter {
+	if config.NStart <= 0 {
+		config.NStart = 1
+	}
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+
+	return &limiter{
+		slots:  make(chan struct{}, config.NStart),
+		rate:   config.Rate,
+		burst:  float64(config.Burst),
+		tokens: float64(config.Burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until an exchange slot is free and a token is available. The slot is taken first, so a
+// request that gives up while waiting for the slot does not use a token
+func (l *limiter) wait(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := l.waitToken(ctx); err != nil {
+		l.release()
+		return err
+	}
+	return nil
+}
+
+func (l *limiter) release() {
+	<-l.slots
+}
+
+func (l *limiter) waitToken(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// acquire waits until the connection's RateLimit allows a new exchange and returns the function that ends it
+func (c *CoapDTLSConnection) acquire(ctx context.Context) (func(), error) {
+	c.limiterOnce.Do(func() {
+		if c.RateLimit != nil {
+			c.limiter = newLimiter(*c.RateLimit)
+		}
+	})
+	l := c.limiter
+
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if err := l.wait(ctx); err != nil {
+		return nil, err
+	}
+	return l.release, nil
+}
@@ -0,0 +1,171 @@
+package gocoap
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// Kinds of Record
+const (
+	RecordRequest      = "request"
+	RecordNotification = "notification"
+)
+
+// Record is a request with its response, or a notification, as written by a Recorder. Time is when the
+// request was sent or the notification received, Duration is the round-trip time of the request. Error is
+// set when the request failed or the notification was an error
+type Record struct {
+	Kind            string         `json:"kind"`
+	Time            time.Time      `json:"time"`
+	Duration        time.Duration  `json:"duration,omitempty"`
+	Method          string         `json:"method,omitempty"`
+	Uri             string         `json:"uri"`
+	Options         []RecordOption `json:"options,omitempty"`
+	Payload         []byte         `json:"payload,omitempty"`
+	Code            codes.Code     `json:"code,omitempty"`
+	ResponseOptions []RecordOption `json:"response_options,omitempty"`
+	Response        []byte         `json:"response,omitempty"`
+	Sequence        uint32         `json:"sequence,omitempty"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// RecordOption is a CoAP option of a Record
+type RecordOption struct {
+	ID    message.OptionID `json:"id"`
+	Value []byte           `json:"value,omitempty"`
+}
+
+// Recorder writes the traffic of a CoapDTLSConnection as JSON lines, one Record per request and
+// notification. Requests are recorded by the Intercept interceptor, notifications by Notification:
+//
+//	rec := gocoap.NewRecorder(file)
+//	conn.Interceptors = []gocoap.Interceptor{rec.Intercept}
+//	conn.OnNotification = rec.Notification
+//
+// Recordings are read with ReadRecords and served with a Replayer
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder returns a Recorder that writes to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing a record
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Intercept is an Interceptor that records the request and its response
+func (r *Recorder) Intercept(ctx context.Context, req *Request, next Invoker) (CoapResponse, error) {
+	start := time.Now()
+	response, err := next(ctx, req)
+
+	options := recordOptions(req.Options)
+	if req.HasContentFormat {
+		options = append(options, uintOption(message.ContentFormat, uint32(req.ContentFormat)))
+	}
+	if req.HasAccept {
+		options = append(options, uintOption(message.Accept, uint32(req.Accept)))
+	}
+
+	record := Record{
+		Kind:            RecordRequest,
+		Time:            start,
+		Duration:        time.Since(start),
+		Method:          req.Method.String(),
+		Uri:             req.uri(),
+		Options:         options,
+		Payload:         req.Payload,
+		Code:            response.Code,
+		ResponseOptions: recordOptions(response.Options),
+		Response:        response.Payload,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	r.write(record)
+
+	return response, err
+}
+
+// Notification records a notification, it is called as OnNotification of a connection. Stale
+// notifications are not received from the gateway and are not recorded
+func (r *Recorder) Notification(notification Notification, err error) {
+	if notification.Stale {
+		return
+	}
+
+	record := Record{
+		Kind:     RecordNotification,
+		Time:     notification.Received,
+		Uri:      notification.Uri,
+		Response: notification.Payload,
+		Sequence: notification.Sequence,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	r.write(record)
+}
+
+func (r *Recorder) write(record Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(record); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// ReadRecords reads the records written by a Recorder
+func ReadRecords(rd io.Reader) ([]Record, error) {
+	var records []Record
+
+	dec := json.NewDecoder(rd)
+	for {
+		var record Record
+		if err := dec.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func recordOptions(opts []message.Option) []RecordOption {
+	var options []RecordOption
+	for _, opt := range opts {
+		options = append(options, RecordOption{ID: opt.ID, Value: append([]byte(nil), opt.Value...)})
+	}
+	return options
+}
+
+func uintOption(id message.OptionID, value uint32) RecordOption {
+	buf := make([]byte, 4)
+	n, _ := message.EncodeUint32(buf, value)
+	return RecordOption{ID: id, Value: buf[:n]}
+}
+
+// recordKey returns the key of a request to uri with method, with the path in the form of CoapServer
+func recordKey(method string, uri string) string {
+	parts := strings.SplitN(uri, "?", 2)
+	key := method + " /" + strings.Trim(parts[0], "/")
+	if len(parts) == 2 && parts[1] != "" {
+		key += "?" + parts[1]
+	}
+	return key
+}
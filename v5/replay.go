@@ -0,0 +1,176 @@
+package gocoap
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// Replayer serves recorded traffic on a CoapServer, so a CoapDTLSConnection can be tested offline against
+// the responses of a real gateway:
+//
+//	records, err := gocoap.ReadRecords(file)
+//	server := &gocoap.CoapServer{Host: "127.0.0.1", Port: 5684, Ident: "test", Key: "secret"}
+//	replayer := gocoap.NewReplayer(records)
+//	replayer.Register(server)
+//	go server.ListenAndServe()
+//
+// Requests are answered with the recorded responses to the same method and URI in order, with the
+// recorded code and options, the last one is repeated. Requests without a recording get 4.04 and
+// requests that failed without response are not replayed. URIs with recorded notifications are observable resources: observations and GET requests
+// receive the first notification, the following ones are sent with Notify or Play. With Realtime
+// responses are delayed by their recorded round-trip time
+type Replayer struct {
+	mu        sync.Mutex
+	Realtime  bool
+	responses map[string][]Record
+	served    map[string]int
+	first     map[string]Record
+	pending   map[string][]Record
+	resources map[string]*ObservableResource
+}
+
+// NewReplayer returns a Replayer for records
+func NewReplayer(records []Record) *Replayer {
+	rp := &Replayer{
+		responses: make(map[string][]Record),
+		served:    make(map[string]int),
+		first:     make(map[string]Record),
+		pending:   make(map[string][]Record),
+		resources: make(map[string]*ObservableResource),
+	}
+
+	for _, record := range records {
+		switch {
+		case record.Kind == RecordRequest && record.Code != 0:
+			key := recordKey(record.Method, record.Uri)
+			rp.responses[key] = append(rp.responses[key], record)
+		case record.Kind == RecordNotification && record.Error == "":
+			uri := "/" + strings.Trim(record.Uri, "/")
+			if _, ok := rp.first[uri]; !ok {
+				rp.first[uri] = record
+			} else {
+				rp.pending[uri] = append(rp.pending[uri], record)
+			}
+		}
+	}
+	return rp
+}
+
+// Register adds the recorded resources to s
+func (rp *Replayer) Register(s *CoapServer) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	for uri, record := range rp.first {
+		rp.resources[uri] = s.Observable(uri, record.Response)
+	}
+
+	registered := make(map[string]bool)
+	for key, records := range rp.responses {
+		path := strings.SplitN(strings.SplitN(key, " ", 2)[1], "?", 2)[0]
+		method := parseMethod(records[0].Method)
+		if method == 0 || registered[records[0].Method+" "+path] {
+			continue
+		}
+		if _, ok := rp.resources[path]; ok && method == GET {
+			continue
+		}
+
+		registered[records[0].Method+" "+path] = true
+		s.HandleResponse(path, method, rp.handler(records[0].Method))
+	}
+}
+
+// Notify sends the next recorded notification of uri to its observers. It returns false when all
+// notifications of uri were sent
+func (rp *Replayer) Notify(uri string) bool {
+	uri = "/" + strings.Trim(uri, "/")
+
+	rp.mu.Lock()
+	resource, ok := rp.resources[uri]
+	pending := rp.pending[uri]
+	if !ok || len(pending) == 0 {
+		rp.mu.Unlock()
+		return false
+	}
+	rp.pending[uri] = pending[1:]
+	rp.mu.Unlock()
+
+	resource.Set(pending[0].Response)
+	return true
+}
+
+// Play sends the remaining notifications of all URIs in the recorded order and with the recorded time
+// between them. It returns when all were sent or ctx is done
+func (rp *Replayer) Play(ctx context.Context) error {
+	rp.mu.Lock()
+	var records []Record
+	for _, pending := range rp.pending {
+		records = append(records, pending...)
+	}
+	rp.mu.Unlock()
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	for i, record := range records {
+		if i > 0 {
+			select {
+			case <-time.After(record.Time.Sub(records[i-1].Time)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		rp.Notify(record.Uri)
+	}
+	return nil
+}
+
+func (rp *Replayer) handler(method string) ServerResponseHandler {
+	return func(req ServerRequest) ServerResponse {
+		uri := req.Uri
+		if len(req.Query) > 0 {
+			uri += "?" + strings.Join(req.Query, "&")
+		}
+		key := recordKey(method, uri)
+
+		rp.mu.Lock()
+		records := rp.responses[key]
+		if len(records) == 0 {
+			rp.mu.Unlock()
+			return ServerResponse{Code: codes.NotFound}
+		}
+		record := records[rp.served[key]]
+		if rp.served[key] < len(records)-1 {
+			rp.served[key]++
+		}
+		realtime := rp.Realtime
+		rp.mu.Unlock()
+
+		if realtime {
+			time.Sleep(record.Duration)
+		}
+
+		var opts message.Options
+		for _, opt := range record.ResponseOptions {
+			opts = append(opts, message.Option{ID: opt.ID, Value: opt.Value})
+		}
+		return ServerResponse{Code: record.Code, Options: opts, Payload: record.Response}
+	}
+}
+
+func parseMethod(method string) RequestMethod {
+	for _, m := range []RequestMethod{GET, PUT, POST, DELETE} {
+		if m.String() == method {
+			return m
+		}
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package gocoap
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+func TestRecordReplay(t *testing.T) {
+	requests := []struct {
+		name    string
+		method  RequestMethod
+		uri     string
+		query   []string
+		payload []byte
+		code    codes.Code
+	}{
+		{"content", GET, "/15001/65537", nil, nil, codes.Content},
+		{"query", GET, "/15001", []string{"type=light"}, nil, codes.Content},
+		{"valid", GET, "/15011/15012", nil, nil, codes.Valid},
+		{"changed", PUT, "/15001/65537", nil, []byte(`{"3311":[{"5850":1}]}`), codes.Changed},
+		{"created", POST, "/15004", nil, []byte(`{"9001":"Group"}`), codes.Created},
+		{"deleted", DELETE, "/15004/131073", nil, nil, codes.Deleted},
+		{"not found", GET, "/15001/1", nil, nil, codes.NotFound},
+		{"bad request", PUT, "/15011/9031", nil, []byte("{"), codes.BadRequest},
+		{"unavailable", GET, "/15011/15012/busy", nil, nil, codes.ServiceUnavailable},
+	}
+
+	gateway := &CoapServer{}
+	gateway.Handle("/15001/65537", GET, func(ServerRequest) ([]byte, error) {
+		return []byte(`{"9001":"Lamp"}`), nil
+	})
+	gateway.Handle("/15001", GET, func(req ServerRequest) ([]byte, error) {
+		return []byte(`[65537]`), nil
+	})
+	gateway.HandleResponse("/15011/15012", GET, func(ServerRequest) ServerResponse {
+		return ServerResponse{Code: codes.Valid, Options: message.Options{
+			{ID: message.ETag, Value: []byte{1, 2, 3, 4}},
+			{ID: message.MaxAge, Value: []byte{30}},
+		}}
+	})
+	gateway.Handle("/15001/65537", PUT, func(ServerRequest) ([]byte, error) { return nil, nil })
+	gateway.Handle("/15004", POST, func(ServerRequest) ([]byte, error) { return []byte(`{"9003":131073}`), nil })
+	gateway.Handle("/15004/131073", DELETE, func(ServerRequest) ([]byte, error) { return nil, nil })
+	gateway.Handle("/15011/9031", PUT, func(ServerRequest) ([]byte, error) { return nil, BadRequest })
+	gateway.HandleResponse("/15011/15012/busy", GET, func(ServerRequest) ServerResponse {
+		return ServerResponse{Code: codes.ServiceUnavailable, Options: message.Options{
+			{ID: message.MaxAge, Value: []byte{5}},
+			{ID: message.ContentFormat, Value: []byte{byte(message.TextPlain)}},
+		}, Payload: []byte("busy")}
+	})
+	testServer(t, gateway)
+
+	record := func(s *CoapServer) []Record {
+		var buf bytes.Buffer
+		rec := NewRecorder(&buf)
+		conn := testConnection(t, s, rec.Intercept)
+		for _, r := range requests {
+			req := NewRequest(r.method, r.uri)
+			req.Query = r.query
+			if r.payload != nil {
+				req.WithContentFormat(message.AppJSON).WithPayload(r.payload)
+			}
+			conn.Send(context.Background(), req, func(CoapResponse, error) {})
+		}
+		if err := rec.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		records, err := ReadRecords(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != len(requests) {
+			t.Fatalf("got %d records, want %d", len(records), len(requests))
+		}
+		return records
+	}
+
+	recorded := record(gateway)
+
+	replay := &CoapServer{}
+	NewReplayer(recorded).Register(replay)
+	testServer(t, replay)
+	replayed := record(replay)
+
+	for i, r := range requests {
+		t.Run(r.name, func(t *testing.T) {
+			want, got := recorded[i], replayed[i]
+			if want.Error != "" || got.Error != "" {
+				t.Fatalf("request failed: recorded %q, replayed %q", want.Error, got.Error)
+			}
+			if want.Code != r.code {
+				t.Errorf("recorded code: got %v, want %v", want.Code, r.code)
+			}
+			if got.Code != want.Code {
+				t.Errorf("code: got %v, want %v", got.Code, want.Code)
+			}
+			if !bytes.Equal(got.Response, want.Response) {
+				t.Errorf("response: got %q, want %q", got.Response, want.Response)
+			}
+			if !reflect.DeepEqual(got.ResponseOptions, want.ResponseOptions) {
+				t.Errorf("response options: got %v, want %v", got.ResponseOptions, want.ResponseOptions)
+			}
+		})
+	}
+}
+
+func TestReplayNotRecorded(t *testing.T) {
+	replay := &CoapServer{}
+	NewReplayer([]Record{
+		{Kind: RecordRequest, Method: "GET", Uri: "/15001", Code: codes.Content, Response: []byte("[]")},
+	}).Register(replay)
+	testServer(t, replay)
+
+	conn := testConnection(t, replay)
+
+	var response CoapResponse
+	conn.Send(context.Background(), NewRequest(GET, "/15001").WithQuery("type", "light"), func(r CoapResponse, err error) {
+		response = r
+	})
+	if response.Code != codes.NotFound {
+		t.Errorf("got %v, want %v", response.Code, codes.NotFound)
+	}
+}
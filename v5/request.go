@@ -0,0 +1,305 @@
+package gocoap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// Largest option value the CoAP option encoding allows
+const maxOptionLength = 65535 + 269
+
+// Request is a CoAP request for CoapDTLSConnection.Send and SendRequest. It is created with NewRequest
+// and configured with the With methods, which return the request for chaining. The segments of Path and
+// the Query items may be percent-encoded:
+//
+//	req := gocoap.NewRequest(gocoap.GET, "/15001").WithQuery("x", "1").WithAccept(message.AppJSON)
+type Request struct {
+	Method           RequestMethod
+	Path             string
+	Query            []string
+	Options          []message.Option
+	ContentFormat    message.MediaType
+	HasContentFormat bool
+	Accept           message.MediaType
+	HasAccept        bool
+	Confirmable      bool
+	Token            []byte
+	Payload          []byte
+}
+
+// NewRequest returns a confirmable request with method for path
+func NewRequest(method RequestMethod, path string) *Request {
+	return &Request{
+		Method:      method,
+		Path:        path,
+		Confirmable: true,
+	}
+}
+
+// WithQuery adds the URI-Query key=value, or key when value is empty
+func (r *Request) WithQuery(key, value string) *Request {
+	if value != "" {
+		key += "=" + value
+	}
+	r.Query = append(r.Query, key)
+	return r
+}
+
+// WithOption adds an option with a raw value, for option numbers without a helper
+func (r *Request) WithOption(id message.OptionID, value []byte) *Request {
+	r.Options = append(r.Options, message.Option{ID: id, Value: value})
+	return r
+}
+
+// WithUintOption adds an option with an unsigned integer value
+func (r *Request) WithUintOption(id message.OptionID, value uint32) *Request {
+	buf := make([]byte, 4)
+	n, _ := message.EncodeUint32(buf, value)
+	return r.WithOption(id, buf[:n])
+}
+
+// WithStringOption adds an option with a string value
+func (r *Request) WithStringOption(id message.OptionID, value string) *Request {
+	return r.WithOption(id, []byte(value))
+}
+
+// WithIfMatch makes the request conditional on the resource having etag, an empty etag matches any
+// existing representation
+func (r *Request) WithIfMatch(etag []byte) *Request {
+	return r.WithOption(message.IfMatch, etag)
+}
+
+// WithIfNoneMatch makes the request conditional on the resource not existing
+func (r *Request) WithIfNoneMatch() *Request {
+	return r.WithOption(message.IfNoneMatch, nil)
+}
+
+// WithETag adds an entity tag the client has cached, the server answers 2.03 Valid if it is current
+func (r *Request) WithETag(etag []byte) *Request {
+	return r.WithOption(message.ETag, etag)
+}
+
+// WithAccept sets the content format the client wants in the response
+func (r *Request) WithAccept(contentFormat message.MediaType) *Request {
+	r.Accept = contentFormat
+	r.HasAccept = true
+	return r
+}
+
+// WithContentFormat sets the content format of the payload
+func (r *Request) WithContentFormat(contentFormat message.MediaType) *Request {
+	r.ContentFormat = contentFormat
+	r.HasContentFormat = true
+	return r
+}
+
+// WithPayload sets the payload
+func (r *Request) WithPayload(payload []byte) *Request {
+	r.Payload = payload
+	return r
+}
+
+// WithToken sets the token of the request, by default a random token is used
+func (r *Request) WithToken(token []byte) *Request {
+	r.Token = token
+	return r
+}
+
+// NonConfirmable sends the request as non-confirmable message, without retransmissions
+func (r *Request) NonConfirmable() *Request {
+	r.Confirmable = false
+	return r
+}
+
+// Validate checks the method, token, URI and options of the request against RFC 7252
+func (r *Request) Validate() error {
+	if r.Method.code() == 0 {
+		return MethodNotAllowed
+	}
+
+	if len(r.Token) > 8 {
+		return fmt.Errorf("%w: token length %d", ErrorInvalidRequest, len(r.Token))
+	}
+
+	for _, segment := range strings.Split(strings.Trim(r.Path, "/"), "/") {
+		if segment = unescape(segment); len(segment) > 255 {
+			return fmt.Errorf("%w: path segment length %d", ErrorInvalidRequest, len(segment))
+		}
+	}
+
+	for _, query := range r.Query {
+		if query = unescape(query); len(query) > 255 {
+			return fmt.Errorf("%w: query length %d", ErrorInvalidRequest, len(query))
+		}
+	}
+
+	for _, opt := range r.Options {
+		if err := validateOption(opt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateOption(opt message.Option) error {
+	def, ok := message.CoapOptionDefs[opt.ID]
+	if !ok {
+		if len(opt.Value) > maxOptionLength {
+			return fmt.Errorf("%w: option %d length %d", ErrorInvalidRequest, opt.ID, len(opt.Value))
+		}
+		return nil
+	}
+
+	if len(opt.Value) < int(def.MinLen) || len(opt.Value) > int(def.MaxLen) {
+		return fmt.Errorf("%w: option %s length %d, expected %d to %d", ErrorInvalidRequest,
+			opt.ID.String(), len(opt.Value), def.MinLen, def.MaxLen)
+	}
+
+	if def.ValueFormat == message.ValueString && !utf8.Valid(opt.Value) {
+		return fmt.Errorf("%w: option %s is not UTF-8", ErrorInvalidRequest, opt.ID.String())
+	}
+
+	return nil
+}
+
+// uri returns the path and query of the request
+func (r *Request) uri() string {
+	if len(r.Query) == 0 {
+		return r.Path
+	}
+	return r.Path + "?" + strings.Join(r.Query, "&")
+}
+
+func (r *Request) accept() int {
+	if r.HasAccept {
+		return int(r.Accept)
+	}
+	return noAccept
+}
+
+// cacheable reports whether the response can be cached. Requests with options may be conditional
+func (r *Request) cacheable() bool {
+	return r.Method == GET && len(r.Options) == 0
+}
+
+// message returns the request as a pooled message, the caller must release it
+func (r *Request) message(ctx context.Context) (*pool.Message, error) {
+	token := message.Token(r.Token)
+	if len(token) == 0 {
+		var err error
+		if token, err = message.GetToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := pool.AcquireMessage(ctx)
+	msg.SetCode(r.Method.code())
+	if r.Confirmable {
+		msg.SetType(udpMessage.Confirmable)
+	} else {
+		msg.SetType(udpMessage.NonConfirmable)
+	}
+	msg.SetToken(token)
+	for _, segment := range strings.Split(strings.Trim(r.Path, "/"), "/") {
+		if segment != "" {
+			msg.AddOptionString(message.URIPath, unescape(segment))
+		}
+	}
+	for _, query := range r.Query {
+		msg.AddQuery(unescape(query))
+	}
+	for _, opt := range r.Options {
+		msg.AddOptionBytes(opt.ID, opt.Value)
+	}
+	if r.HasContentFormat {
+		msg.SetContentFormat(r.ContentFormat)
+	}
+	if r.HasAccept {
+		msg.SetAccept(r.Accept)
+	}
+	if len(r.Payload) > 0 {
+		msg.SetBody(bytes.NewReader(r.Payload))
+	}
+
+	return msg, nil
+}
+
+func (m RequestMethod) code() codes.Code {
+	switch m {
+	case GET:
+		return codes.GET
+	case PUT:
+		return codes.PUT
+	case POST:
+		return codes.POST
+	case DELETE:
+		return codes.DELETE
+	}
+	return 0
+}
+
+// SendRequest sends req to the gateway in params, with DTLS when params.Id is set
+func SendRequest(params RequestParams, req *Request) (CoapResponse, error) {
+	if err := req.Validate(); err != nil {
+		return CoapResponse{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), params.Transmission.timeout(time.Second))
+	defer cancel()
+
+	response, err := chain(getInterceptors(), params.send)(ctx, req)
+	if err != nil {
+		return response, err
+	}
+	return response, processCode(response.Code)
+}
+
+// send sends req to the gateway, it is the last Invoker of the interceptor chain of SendRequest
+func (params RequestParams) send(ctx context.Context, req *Request) (CoapResponse, error) {
+	var co *client.ClientConn
+	var err error
+	if params.Id != "" {
+		co, err = getDTLSConnection(params)
+	} else {
+		co, err = udp.Dial(params.getHost())
+		if err == nil {
+			defer co.Close()
+		}
+	}
+	if err != nil {
+		return CoapResponse{}, err
+	}
+
+	msg, err := req.message(ctx)
+	if err != nil {
+		return CoapResponse{}, err
+	}
+	defer pool.ReleaseMessage(msg)
+
+	start := time.Now()
+	resp, err := co.Do(msg)
+	recordRequest(_metrics, params.getHost(), req.Method, start, resp, err)
+	if params.Id != "" {
+		params.Debug.capture(_localAddr, co.RemoteAddr(), msg, true, start)
+	}
+	if err != nil {
+		return CoapResponse{}, err
+	}
+	if params.Id != "" {
+		params.Debug.capture(_localAddr, co.RemoteAddr(), resp, false, time.Now())
+	}
+
+	return newCoapResponse(resp)
+}
@@ -0,0 +1,39 @@
+package gocoap
+
+import (
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// CoapResponse is the complete response to a request, for callers that need more than the payload
+type CoapResponse struct {
+	Code             codes.Code
+	ContentFormat    message.MediaType
+	HasContentFormat bool
+	Options          message.Options
+	Payload          []byte
+}
+
+func newCoapResponse(msg *pool.Message) (CoapResponse, error) {
+	response := CoapResponse{
+		Code: msg.Code(),
+	}
+
+	if cf, err := msg.ContentFormat(); err == nil {
+		response.ContentFormat = cf
+		response.HasContentFormat = true
+	}
+
+	if opts, err := msg.Options().Clone(); err == nil {
+		response.Options = opts
+	}
+
+	m, err := msg.ReadBody()
+	if err != nil {
+		return response, err
+	}
+	response.Payload = m
+
+	return response, nil
+}
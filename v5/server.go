@@ -0,0 +1,451 @@
+package gocoap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	piondtls "github.com/pion/dtls/v2"
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServerRequest is an incoming request passed to a ServerHandler
+type ServerRequest struct {
+	Method     RequestMethod
+	Uri        string
+	Query      []string
+	Payload    []byte
+	RemoteAddr net.Addr
+}
+
+// ServerHandler handles a request to a resource. The returned error is mapped to the response code,
+// UriNotFound to 4.04, MethodNotAllowed to 4.05, BadRequest to 4.00, Unauthorized to 4.01 and any other error to 5.00
+type ServerHandler func(req ServerRequest) ([]byte, error)
+
+// ServerResponse is a response written by a ServerResponseHandler. The Content-Format option of Options
+// is used for the payload, application/json when there is none
+type ServerResponse struct {
+	Code    codes.Code
+	Options message.Options
+	Payload []byte
+}
+
+// ServerResponseHandler handles a request like ServerHandler, but sets the code and options of the
+// response itself
+type ServerResponseHandler func(req ServerRequest) ServerResponse
+
+// CoapServer serves resources over plain UDP or, when Ident and Key are set, DTLS-PSK
+type CoapServer struct {
+	mu           sync.Mutex
+	Host         string
+	Port         int
+	Ident        string
+	Key          string
+	SessionStore piondtls.SessionStore
+	router       *mux.Router
+	resources    map[string]*serverResource
+	stop         func()
+	done         chan struct{}
+}
+
+type serverResource struct {
+	handlers   map[RequestMethod]ServerResponseHandler
+	observable *ObservableResource
+}
+
+// ObservableResource is a resource whose state is pushed to observers when it changes
+type ObservableResource struct {
+	mu        sync.Mutex
+	payload   []byte
+	sequence  uint32
+	observers map[string]*serverObserver
+}
+
+type serverObserver struct {
+	cc    *client.ClientConn
+	token message.Token
+}
+
+func (s *CoapServer) init() {
+	if s.router == nil {
+		s.router = mux.NewRouter()
+		s.resources = make(map[string]*serverResource)
+	}
+}
+
+func (s *CoapServer) resource(uri string) *serverResource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.init()
+
+	uri = "/" + strings.Trim(uri, "/")
+	if r, ok := s.resources[uri]; ok {
+		return r
+	}
+
+	r := &serverResource{handlers: make(map[RequestMethod]ServerResponseHandler)}
+	s.resources[uri] = r
+	s.router.Handle(uri, mux.HandlerFunc(func(w mux.ResponseWriter, req *mux.Message) {
+		s.serve(r, w, req)
+	}))
+	return r
+}
+
+// Handle registers handler for requests with method to uri
+func (s *CoapServer) Handle(uri string, method RequestMethod, handler ServerHandler) {
+	s.HandleResponse(uri, method, func(req ServerRequest) ServerResponse {
+		payload, err := handler(req)
+		code := responseCode(req.Method, err)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Uri":   req.Uri,
+				"Code":  code.String(),
+				"Error": err.Error(),
+			}).Debug("CoapServer: Handler failed")
+		}
+		return ServerResponse{Code: code, Payload: payload}
+	})
+}
+
+// HandleResponse registers handler for requests with method to uri, it replaces a handler registered
+// with Handle
+func (s *CoapServer) HandleResponse(uri string, method RequestMethod, handler ServerResponseHandler) {
+	r := s.resource(uri)
+
+	s.mu.Lock()
+	r.handlers[method] = handler
+	s.mu.Unlock()
+}
+
+// Observable registers an observable resource at uri with an initial payload. GET requests are answered
+// with the current payload, and observers are notified every time it is changed with Set
+func (s *CoapServer) Observable(uri string, payload []byte) *ObservableResource {
+	r := s.resource(uri)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.observable == nil {
+		r.observable = &ObservableResource{
+			payload:   payload,
+			sequence:  2,
+			observers: make(map[string]*serverObserver),
+		}
+	}
+	return r.observable
+}
+
+func (s *CoapServer) serve(r *serverResource, w mux.ResponseWriter, req *mux.Message) {
+	path, _ := req.Options.Path()
+	query, _ := req.Options.Queries()
+
+	var payload []byte
+	if req.Body != nil {
+		payload, _ = io.ReadAll(req.Body)
+	}
+
+	request := ServerRequest{
+		Method:     methodFromCode(req.Code),
+		Uri:        path,
+		Query:      query,
+		Payload:    payload,
+		RemoteAddr: w.Client().RemoteAddr(),
+	}
+
+	s.mu.Lock()
+	handler, ok := r.handlers[request.Method]
+	observable := r.observable
+	s.mu.Unlock()
+
+	if request.Method == GET && observable != nil && !ok {
+		observable.serve(w, req)
+		return
+	}
+
+	if !ok {
+		w.SetResponse(codes.MethodNotAllowed, message.TextPlain, nil)
+		return
+	}
+
+	resp := handler(request)
+
+	contentFormat := message.AppJSON
+	var opts message.Options
+	for _, opt := range resp.Options {
+		if opt.ID == message.ContentFormat {
+			if value, _, err := message.DecodeUint32(opt.Value); err == nil {
+				contentFormat = message.MediaType(value)
+			}
+			continue
+		}
+		opts = append(opts, opt)
+	}
+
+	if resp.Payload == nil {
+		w.SetResponse(resp.Code, contentFormat, nil, opts...)
+		return
+	}
+	w.SetResponse(resp.Code, contentFormat, bytes.NewReader(resp.Payload), opts...)
+}
+
+// ListenAndServe listens on Host:Port and serves requests until Shutdown is called
+func (s *CoapServer) ListenAndServe() error {
+	s.mu.Lock()
+	s.init()
+
+	if s.done != nil {
+		s.mu.Unlock()
+		return ErrorServerRunning
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	var serve func() error
+
+	if s.Key != "" {
+		l, err := coapNet.NewDTLSListener("udp", addr, s.dtlsConfig())
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		server := dtls.NewServer(dtls.WithMux(s.router), dtls.WithErrors(serverError))
+		s.stop = func() {
+			server.Stop()
+			l.Close()
+		}
+		serve = func() error { return server.Serve(l) }
+	} else {
+		l, err := coapNet.NewListenUDP("udp", addr)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		server := udp.NewServer(udp.WithMux(s.router), udp.WithErrors(serverError))
+		s.stop = func() {
+			server.Stop()
+			l.Close()
+		}
+		serve = func() error { return server.Serve(l) }
+	}
+
+	done := make(chan struct{})
+	s.done = done
+	s.mu.Unlock()
+
+	err := serve()
+	close(done)
+
+	s.mu.Lock()
+	s.done = nil
+	s.mu.Unlock()
+
+	return err
+}
+
+// Shutdown stops the server and cancels all observations. It waits for ListenAndServe to return or ctx to be done
+func (s *CoapServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	var observables []*ObservableResource
+	for _, r := range s.resources {
+		if r.observable != nil {
+			observables = append(observables, r.observable)
+		}
+	}
+	s.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+
+	for _, o := range observables {
+		o.cancelAll(ctx)
+	}
+
+	stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *CoapServer) dtlsConfig() *piondtls.Config {
+	config := dtlsConfig(s.Ident, s.Key)
+	config.SessionStore = s.SessionStore
+	config.PSK = func(hint []byte) ([]byte, error) {
+		if s.Ident != "" && string(hint) != s.Ident {
+			return nil, ErrorBadIdent
+		}
+		return []byte(s.Key), nil
+	}
+	return config
+}
+
+// Get returns the current payload of the resource
+func (o *ObservableResource) Get() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.payload
+}
+
+// Set changes the payload of the resource and notifies all observers
+func (o *ObservableResource) Set(payload []byte) {
+	o.mu.Lock()
+	o.payload = payload
+	o.sequence = (o.sequence + 1) & 0xffffff
+	sequence := o.sequence
+	observers := make(map[string]*serverObserver, len(o.observers))
+	for k, v := range o.observers {
+		observers[k] = v
+	}
+	o.mu.Unlock()
+
+	for key, obs := range observers {
+		if err := obs.notify(codes.Content, sequence, payload); err != nil {
+			log.WithFields(log.Fields{
+				"Addr":  obs.cc.RemoteAddr().String(),
+				"Error": err.Error(),
+			}).Debug("CoapServer: Removing observer")
+			o.remove(key)
+		}
+	}
+}
+
+// Observers returns the number of registered observers
+func (o *ObservableResource) Observers() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.observers)
+}
+
+func (o *ObservableResource) serve(w mux.ResponseWriter, req *mux.Message) {
+	cc, ok := w.Client().ClientConn().(*client.ClientConn)
+	obs, err := req.Options.Observe()
+	register := err == nil && obs == 0 && ok
+	deregister := err == nil && obs == 1
+	key := observerKey(w.Client().RemoteAddr(), req.Token)
+
+	o.mu.Lock()
+	payload, sequence := o.payload, o.sequence
+	if _, exists := o.observers[key]; register && !exists {
+		o.observers[key] = &serverObserver{cc: cc, token: append(message.Token(nil), req.Token...)}
+		cc.AddOnClose(func() {
+			o.remove(key)
+		})
+	}
+	if deregister {
+		delete(o.observers, key)
+	}
+	o.mu.Unlock()
+
+	var opts message.Options
+	if register {
+		buf := make([]byte, 4)
+		n, _ := message.EncodeUint32(buf, sequence)
+		opts = append(opts, message.Option{ID: message.Observe, Value: buf[:n]})
+	}
+
+	w.SetResponse(codes.Content, message.AppJSON, bytes.NewReader(payload), opts...)
+}
+
+func (o *ObservableResource) remove(key string) {
+	o.mu.Lock()
+	delete(o.observers, key)
+	o.mu.Unlock()
+}
+
+func (o *ObservableResource) cancelAll(ctx context.Context) {
+	o.mu.Lock()
+	observers := o.observers
+	o.observers = make(map[string]*serverObserver)
+	o.mu.Unlock()
+
+	// Any non-2.xx notification terminates the observation on the client (RFC 7641 section 3.2)
+	for _, obs := range observers {
+		obs.notifyCtx(ctx, codes.ServiceUnavailable, 0, nil)
+	}
+}
+
+func (obs *serverObserver) notify(code codes.Code, sequence uint32, payload []byte) error {
+	return obs.notifyCtx(obs.cc.Context(), code, sequence, payload)
+}
+
+func (obs *serverObserver) notifyCtx(ctx context.Context, code codes.Code, sequence uint32, payload []byte) error {
+	msg := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(msg)
+
+	msg.SetCode(code)
+	msg.SetToken(obs.token)
+	msg.SetType(udpMessage.NonConfirmable)
+	if code == codes.Content {
+		msg.SetObserve(sequence)
+		msg.SetContentFormat(message.AppJSON)
+		msg.SetBody(bytes.NewReader(payload))
+	}
+	return obs.cc.WriteMessage(msg)
+}
+
+func serverError(err error) {
+	log.WithFields(log.Fields{
+		"Error": err.Error(),
+	}).Debug("CoapServer")
+}
+
+func observerKey(addr net.Addr, token message.Token) string {
+	return addr.String() + "/" + token.String()
+}
+
+func methodFromCode(code codes.Code) RequestMethod {
+	switch code {
+	case codes.GET:
+		return GET
+	case codes.PUT:
+		return PUT
+	case codes.POST:
+		return POST
+	case codes.DELETE:
+		return DELETE
+	}
+	return 0
+}
+
+func responseCode(method RequestMethod, err error) codes.Code {
+	switch {
+	case err == nil:
+		switch method {
+		case GET:
+			return codes.Content
+		case POST:
+			return codes.Created
+		case DELETE:
+			return codes.Deleted
+		}
+		return codes.Changed
+	case errors.Is(err, UriNotFound):
+		return codes.NotFound
+	case errors.Is(err, MethodNotAllowed):
+		return codes.MethodNotAllowed
+	case errors.Is(err, BadRequest):
+		return codes.BadRequest
+	case errors.Is(err, Unauthorized):
+		return codes.Unauthorized
+	}
+	return codes.InternalServerError
+}
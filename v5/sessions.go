@@ -0,0 +1,102 @@
+package gocoap
+
+import (
+	"sync"
+	"sync/atomic"
+
+	piondtls "github.com/pion/dtls/v2"
+)
+
+// SessionCache is an in-memory DTLS session store. Set it as SessionStore of a CoapDTLSConnection to
+// resume the DTLS session on reconnect instead of performing a full PSK handshake, or of a CoapServer to
+// allow clients to resume their sessions.
+//
+// RFC 9146 Connection IDs, which keep a session working when the NAT mapping of the client changes, are
+// not supported by pion/dtls v2. After an address change the connection reconnects, with resumption that
+// costs one round trip instead of two
+type SessionCache struct {
+	mu       sync.Mutex
+	sessions map[string]piondtls.Session
+}
+
+// NewSessionCache returns an empty SessionCache
+func NewSessionCache() *SessionCache {
+	return &SessionCache{}
+}
+
+func (s *SessionCache) Set(key []byte, session piondtls.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sessions == nil {
+		s.sessions = make(map[string]piondtls.Session)
+	}
+	s.sessions[string(key)] = session
+	return nil
+}
+
+// Get returns the session stored for key, or an empty session when there is none
+func (s *SessionCache) Get(key []byte) (piondtls.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[string(key)], nil
+}
+
+func (s *SessionCache) Del(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, string(key))
+	return nil
+}
+
+// HandshakeStats counts the completed DTLS handshakes of a connection
+type HandshakeStats struct {
+	Full    uint64
+	Resumed uint64
+}
+
+type handshakeCounter struct {
+	full    uint64
+	resumed uint64
+}
+
+func (h *handshakeCounter) record(resumed bool) {
+	if resumed {
+		atomic.AddUint64(&h.resumed, 1)
+	} else {
+		atomic.AddUint64(&h.full, 1)
+	}
+}
+
+func (h *handshakeCounter) stats() HandshakeStats {
+	return HandshakeStats{
+		Full:    atomic.LoadUint64(&h.full),
+		Resumed: atomic.LoadUint64(&h.resumed),
+	}
+}
+
+// sessionTracker wraps the SessionStore of a single handshake. The client offers a stored session and
+// only saves a session after a full handshake, so an offered session that isn't replaced was resumed
+type sessionTracker struct {
+	piondtls.SessionStore
+	offered bool
+	saved   bool
+}
+
+func (t *sessionTracker) Get(key []byte) (piondtls.Session, error) {
+	session, err := t.SessionStore.Get(key)
+	if err == nil && len(session.ID) > 0 {
+		t.offered = true
+	}
+	return session, err
+}
+
+func (t *sessionTracker) Set(key []byte, session piondtls.Session) error {
+	t.saved = true
+	return t.SessionStore.Set(key, session)
+}
+
+func (t *sessionTracker) resumed() bool {
+	return t != nil && t.offered && !t.saved
+}
@@ -0,0 +1,206 @@
+package gocoap
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Notifications buffered per subscriber when CoapDTLSConnection.SubscriptionBuffer is 0
+const defaultSubscriptionBuffer = 16
+
+// Subscription is a subscriber to a shared observation, see Subscribe
+type Subscription struct {
+	Uri     string
+	c       *CoapDTLSConnection
+	shared  *sharedObservation
+	events  chan subscriptionEvent
+	done    chan struct{}
+	once    sync.Once
+	dropped uint64
+}
+
+type subscriptionEvent struct {
+	notification Notification
+	err          error
+}
+
+// sharedObservation is the upstream observation of an uri and its subscribers
+type sharedObservation struct {
+	mu          sync.Mutex
+	uri         string
+	ready       chan struct{}
+	observation *CoapDTLSObservation
+	err         error
+	subscribers map[*Subscription]struct{}
+	last        *Notification
+}
+
+// Subscribe adds a subscriber to the observation of uri. All subscribers of an uri share one observation
+// with the gateway, it is registered by the first subscriber and cancelled when the last subscription is
+// cancelled. Subscribers joining an existing observation first receive the last notification.
+//
+// handler is called from a goroutine per subscriber with up to SubscriptionBuffer notifications buffered.
+// When a subscriber falls behind its oldest buffered notification is dropped, so a slow handler never
+// blocks the other subscribers
+func (c *CoapDTLSConnection) Subscribe(ctx context.Context, uri string, handler func(Notification, error)) (*Subscription, error) {
+	size := c.SubscriptionBuffer
+	if size <= 0 {
+		size = defaultSubscriptionBuffer
+	}
+
+	c.subsMu.Lock()
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[string]*sharedObservation)
+	}
+	shared, ok := c.subscriptions[uri]
+	if !ok {
+		shared = &sharedObservation{
+			uri:         uri,
+			ready:       make(chan struct{}),
+			subscribers: make(map[*Subscription]struct{}),
+		}
+		c.subscriptions[uri] = shared
+	}
+
+	s := &Subscription{
+		Uri:    uri,
+		c:      c,
+		shared: shared,
+		events: make(chan subscriptionEvent, size),
+		done:   make(chan struct{}),
+	}
+	shared.add(s)
+	c.subsMu.Unlock()
+
+	go s.run(handler)
+
+	if !ok {
+		shared.observation, shared.err = c.ObserveNotifications(ctx, uri, shared.publish)
+		close(shared.ready)
+	} else {
+		select {
+		case <-shared.ready:
+		case <-ctx.Done():
+			s.Cancel(context.Background())
+			return nil, ctx.Err()
+		}
+	}
+
+	if shared.err != nil {
+		s.Cancel(context.Background())
+		return nil, shared.err
+	}
+	return s, nil
+}
+
+// Cancel removes the subscriber. The observation with the gateway is cancelled with the last subscription
+func (s *Subscription) Cancel(ctx context.Context) error {
+	cancelled := false
+	s.once.Do(func() {
+		close(s.done)
+		cancelled = true
+	})
+	if !cancelled {
+		return nil
+	}
+
+	c := s.c
+	c.subsMu.Lock()
+	last := s.shared.remove(s)
+	if last && c.subscriptions[s.Uri] == s.shared {
+		delete(c.subscriptions, s.Uri)
+	}
+	c.subsMu.Unlock()
+
+	if !last {
+		return nil
+	}
+
+	<-s.shared.ready
+	if s.shared.observation == nil {
+		return nil
+	}
+	return s.shared.observation.Cancel(ctx)
+}
+
+// Dropped returns the number of notifications dropped because the subscriber fell behind
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Subscribers returns the number of subscribers to uri
+func (c *CoapDTLSConnection) Subscribers(uri string) int {
+	c.subsMu.Lock()
+	shared, ok := c.subscriptions[uri]
+	c.subsMu.Unlock()
+
+	if !ok {
+		return 0
+	}
+
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	return len(shared.subscribers)
+}
+
+func (s *Subscription) run(handler func(Notification, error)) {
+	for {
+		select {
+		case event := <-s.events:
+			handler(event.notification, event.err)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// push buffers event, dropping the oldest buffered event when the buffer is full. Events are pushed
+// with the lock of the shared observation held, so there is a single sender
+func (s *Subscription) push(event subscriptionEvent) {
+	for {
+		select {
+		case s.events <- event:
+			return
+		default:
+		}
+
+		select {
+		case <-s.events:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+	}
+}
+
+func (o *sharedObservation) add(s *Subscription) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.subscribers[s] = struct{}{}
+	if o.last != nil {
+		s.push(subscriptionEvent{notification: *o.last})
+	}
+}
+
+// remove removes s and reports whether it was the last subscriber
+func (o *sharedObservation) remove(s *Subscription) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.subscribers, s)
+	return len(o.subscribers) == 0
+}
+
+func (o *sharedObservation) publish(notification Notification, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err == nil && !notification.Stale {
+		o.last = &notification
+	}
+
+	for s := range o.subscribers {
+		s.push(subscriptionEvent{notification: notification, err: err})
+	}
+}
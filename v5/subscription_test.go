@@ -0,0 +1,173 @@
+package gocoap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testSubscriber returns a subscription handler that sends the payloads it receives on the returned channel
+func testSubscriber() (func(Notification, error), chan string) {
+	payloads := make(chan string, 16)
+	return func(notification Notification, err error) {
+		if err == nil {
+			payloads <- string(notification.Payload)
+		}
+	}, payloads
+}
+
+// waitPayload waits for payload on payloads
+func waitPayload(t *testing.T, payloads chan string, want string) {
+	t.Helper()
+
+	select {
+	case got := <-payloads:
+		if got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no notification, want %s", want)
+	}
+}
+
+// waitObservers waits until the resource has want observers
+func waitObservers(t *testing.T, o *ObservableResource, want int) {
+	t.Helper()
+
+	for start := time.Now(); o.Observers() != want; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatalf("got %d observers at the gateway, want %d", o.Observers(), want)
+		}
+	}
+}
+
+func TestSubscribeShared(t *testing.T) {
+	s := &CoapServer{}
+	lamp := s.Observable("/15001/65536", []byte(`{"5850":0}`))
+	testServer(t, s)
+	conn := testConnection(t, s)
+
+	first, firstPayloads := testSubscriber()
+	a, err := conn.Subscribe(context.Background(), "/15001/65536", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitPayload(t, firstPayloads, `{"5850":0}`)
+
+	lamp.Set([]byte(`{"5850":1}`))
+	waitPayload(t, firstPayloads, `{"5850":1}`)
+
+	// The second subscriber shares the observation and starts with the last notification
+	second, secondPayloads := testSubscriber()
+	b, err := conn.Subscribe(context.Background(), "/15001/65536", second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitPayload(t, secondPayloads, `{"5850":1}`)
+	if lamp.Observers() != 1 || conn.Subscribers("/15001/65536") != 2 {
+		t.Fatalf("got %d observers and %d subscribers, want 1 and 2", lamp.Observers(), conn.Subscribers("/15001/65536"))
+	}
+
+	lamp.Set([]byte(`{"5850":0}`))
+	waitPayload(t, firstPayloads, `{"5850":0}`)
+	waitPayload(t, secondPayloads, `{"5850":0}`)
+
+	// The observation is cancelled with the last subscription
+	a.Cancel(context.Background())
+	waitObservers(t, lamp, 1)
+	b.Cancel(context.Background())
+	waitObservers(t, lamp, 0)
+	if n := conn.Subscribers("/15001/65536"); n != 0 {
+		t.Fatalf("got %d subscribers, want none", n)
+	}
+}
+
+func TestSubscribeDuringNotification(t *testing.T) {
+	tests := []struct {
+		name string
+		// during is called by the handler of the first subscriber on its first change
+		during func(t *testing.T, conn *CoapDTLSConnection, self, other *Subscription)
+		// subscribers is the number of subscribers after the notification
+		subscribers int
+	}{
+		{
+			name: "cancel self",
+			during: func(t *testing.T, conn *CoapDTLSConnection, self, other *Subscription) {
+				self.Cancel(context.Background())
+			},
+			subscribers: 1,
+		},
+		{
+			name: "cancel other",
+			during: func(t *testing.T, conn *CoapDTLSConnection, self, other *Subscription) {
+				other.Cancel(context.Background())
+			},
+			subscribers: 1,
+		},
+		{
+			name: "cancel both",
+			during: func(t *testing.T, conn *CoapDTLSConnection, self, other *Subscription) {
+				self.Cancel(context.Background())
+				other.Cancel(context.Background())
+			},
+		},
+		{
+			name: "subscribe",
+			during: func(t *testing.T, conn *CoapDTLSConnection, self, other *Subscription) {
+				handler, _ := testSubscriber()
+				if _, err := conn.Subscribe(context.Background(), "/15001/65536", handler); err != nil {
+					t.Error(err)
+				}
+			},
+			subscribers: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &CoapServer{}
+			lamp := s.Observable("/15001/65536", []byte(`{"5850":0}`))
+			testServer(t, s)
+			conn := testConnection(t, s)
+
+			var self, other *Subscription
+			subscribed := make(chan struct{})
+			done := make(chan struct{})
+			var err error
+			self, err = conn.Subscribe(context.Background(), "/15001/65536", func(notification Notification, err error) {
+				if string(notification.Payload) != `{"5850":1}` {
+					return
+				}
+				<-subscribed
+				tt.during(t, conn, self, other)
+				close(done)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler, payloads := testSubscriber()
+			other, err = conn.Subscribe(context.Background(), "/15001/65536", handler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			close(subscribed)
+			waitPayload(t, payloads, `{"5850":0}`)
+
+			lamp.Set([]byte(`{"5850":1}`))
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("handler did not return")
+			}
+
+			if n := conn.Subscribers("/15001/65536"); n != tt.subscribers {
+				t.Fatalf("got %d subscribers, want %d", n, tt.subscribers)
+			}
+			observers := 1
+			if tt.subscribers == 0 {
+				observers = 0
+			}
+			waitObservers(t, lamp, observers)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package gocoap
+
+import (
+	"context"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/moroen/gocoap/v5"
+
+var _tracerProvider trace.TracerProvider
+
+// SetTracerProvider sets the OpenTelemetry TracerProvider used by the package-level request functions and by
+// connections without their own TracerProvider. Without one the global provider from otel is used
+func SetTracerProvider(tp trace.TracerProvider) {
+	_tracerProvider = tp
+}
+
+func getTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = _tracerProvider
+	}
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+type retriesKey struct{}
+
+// withRetries marks ctx as belonging to a request that has been replayed from the queue retries times
+func withRetries(ctx context.Context, retries int) context.Context {
+	return context.WithValue(ctx, retriesKey{}, retries)
+}
+
+func retriesFromContext(ctx context.Context) int {
+	if retries, ok := ctx.Value(retriesKey{}).(int); ok {
+		return retries
+	}
+	return 0
+}
+
+func startRequestSpan(ctx context.Context, tracer trace.Tracer, host string, method RequestMethod, uri string, payload int) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "CoAP "+method.String(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("coap.method", method.String()),
+			attribute.String("coap.uri", uri),
+			attribute.String("net.peer.name", host),
+			attribute.Int("coap.request.size", payload),
+			attribute.Int("coap.retries", retriesFromContext(ctx)),
+		),
+	)
+}
+
+func endRequestSpan(span trace.Span, code codes.Code, response int, err error) {
+	if code != 0 {
+		span.SetAttributes(
+			attribute.String("coap.code", code.String()),
+			attribute.Int("coap.response.size", response),
+		)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,218 @@
+package gocoap
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+)
+
+// Transmission parameters of RFC 7252 section 4.8
+const (
+	defaultAckTimeout      = 2 * time.Second
+	defaultAckRandomFactor = 1.5
+	defaultMaxRetransmit   = 4
+)
+
+// Bounds of the adaptive retransmission timeout
+const (
+	minRTO = 250 * time.Millisecond
+	maxRTO = 60 * time.Second
+)
+
+// Transmission holds the CoAP transmission parameters of a connection (RFC 7252 section 4.8). Confirmable
+// requests are retransmitted MaxRetransmit times, every retransmission timeout (RTO). The RTO starts at
+// AckTimeout, randomized up to AckTimeout * AckRandomFactor. Zero fields use the defaults of the RFC, 2s,
+// 1.5 and 4. NSTART is set with RateLimit.
+//
+// With Adaptive the RTO follows the round-trip times measured to the gateway, as in CoCoA
+// (draft-ietf-core-cocoa): responses to requests that were not retransmitted update a strong estimator,
+// responses that took longer than the RTO update a weak estimator. The RTO of a CoapDTLSConnection and its
+// estimators are returned by RTTStats
+type Transmission struct {
+	AckTimeout      time.Duration
+	AckRandomFactor float64
+	MaxRetransmit   int
+	Adaptive        bool
+}
+
+// RTTStats are the round-trip time statistics of a connection. Strong and Weak are the smoothed round-trip
+// times of the two estimators, Last is the latest sample
+type RTTStats struct {
+	RTO           time.Duration
+	Strong        time.Duration
+	StrongSamples uint64
+	Weak          time.Duration
+	WeakSamples   uint64
+	Last          time.Duration
+}
+
+func (t *Transmission) ackTimeout() time.Duration {
+	if t == nil || t.AckTimeout <= 0 {
+		return defaultAckTimeout
+	}
+	return t.AckTimeout
+}
+
+func (t *Transmission) ackRandomFactor() float64 {
+	if t == nil || t.AckRandomFactor < 1 {
+		return defaultAckRandomFactor
+	}
+	return t.AckRandomFactor
+}
+
+func (t *Transmission) maxRetransmit() int {
+	if t == nil || t.MaxRetransmit <= 0 {
+		return defaultMaxRetransmit
+	}
+	return t.MaxRetransmit
+}
+
+// randomize returns a random timeout between rto and rto * AckRandomFactor
+func (t *Transmission) randomize(rto time.Duration) time.Duration {
+	return rto + time.Duration(rand.Float64()*(t.ackRandomFactor()-1)*float64(rto))
+}
+
+// exchangeTimeout returns how long a request with rto takes with all its retransmissions
+func (t *Transmission) exchangeTimeout(rto time.Duration) time.Duration {
+	return time.Duration(float64(rto) * t.ackRandomFactor() * float64(t.maxRetransmit()+1))
+}
+
+// timeout returns the time to wait for the response to a request, or fallback without transmission
+// parameters
+func (t *Transmission) timeout(fallback time.Duration) time.Duration {
+	if t == nil {
+		return fallback
+	}
+	return t.exchangeTimeout(t.ackTimeout())
+}
+
+// dialOptions returns the options that configure the retransmissions of a DTLS connection with rto
+func (t *Transmission) dialOptions(rto time.Duration) []dtls.DialOption {
+	if t == nil {
+		return nil
+	}
+	return []dtls.DialOption{dtls.WithTransmission(0, t.randomize(rto), t.maxRetransmit())}
+}
+
+// rttFilter is a smoothed round-trip time estimator as in RFC 6298
+type rttFilter struct {
+	srtt    time.Duration
+	rttvar  time.Duration
+	samples uint64
+}
+
+// update adds rtt to the estimate and returns the RTO with variance factor k
+func (f *rttFilter) update(rtt time.Duration, k time.Duration) time.Duration {
+	if f.samples == 0 {
+		f.srtt = rtt
+		f.rttvar = rtt / 2
+	} else {
+		delta := f.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		f.rttvar = (3*f.rttvar + delta) / 4
+		f.srtt = (7*f.srtt + rtt) / 8
+	}
+	f.samples++
+	return f.srtt + k*f.rttvar
+}
+
+// rttEstimator is the CoCoA retransmission timeout of a peer
+type rttEstimator struct {
+	mu      sync.Mutex
+	rto     time.Duration
+	updated time.Time
+	initial time.Duration
+	strong  rttFilter
+	weak    rttFilter
+	last    time.Duration
+}
+
+// current returns the RTO, aged towards the initial RTO when there were no samples for a while
+func (e *rttEstimator) current(t *Transmission) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.rto == 0 {
+		e.initial = t.ackTimeout()
+		e.rto = e.initial
+		e.updated = time.Now()
+	}
+
+	idle := time.Since(e.updated)
+	if e.rto < time.Second && idle > 16*e.rto {
+		e.rto *= 2
+		e.updated = time.Now()
+	} else if e.rto > 3*time.Second && idle > 4*e.rto {
+		e.rto = (e.rto + e.initial) / 2
+		e.updated = time.Now()
+	}
+	return e.rto
+}
+
+// sample adds a round-trip time. rtt is weak when it exceeded the RTO, so the request was retransmitted
+// and the response may belong to any transmission
+func (e *rttEstimator) sample(rtt time.Duration) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.last = rtt
+	if rtt <= e.rto {
+		e.rto = e.rto/2 + e.strong.update(rtt, 4)/2
+	} else {
+		e.rto = 3*e.rto/4 + e.weak.update(rtt, 1)/4
+	}
+
+	if e.rto < minRTO {
+		e.rto = minRTO
+	} else if e.rto > maxRTO {
+		e.rto = maxRTO
+	}
+	e.updated = time.Now()
+	return e.rto
+}
+
+func (e *rttEstimator) stats() RTTStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return RTTStats{
+		RTO:           e.rto,
+		Strong:        e.strong.srtt,
+		StrongSamples: e.strong.samples,
+		Weak:          e.weak.srtt,
+		WeakSamples:   e.weak.samples,
+		Last:          e.last,
+	}
+}
+
+// RTTStats returns the round-trip time statistics of the connection. RTO is the retransmission timeout in
+// use, it only adapts when Transmission.Adaptive is set
+func (c *CoapDTLSConnection) RTTStats() RTTStats {
+	c.rtt.current(c.Transmission)
+	return c.rtt.stats()
+}
+
+// requestTimeout returns the time to wait for the response to a request, or fallback without
+// transmission parameters
+func (c *CoapDTLSConnection) requestTimeout(fallback time.Duration) time.Duration {
+	if c.Transmission == nil {
+		return fallback
+	}
+	return c.Transmission.exchangeTimeout(c.rtt.current(c.Transmission))
+}
+
+// sampleRTT updates the RTO of conn with the round-trip time of a request sent at start
+func (c *CoapDTLSConnection) sampleRTT(conn *client.ClientConn, start time.Time, err error) {
+	if c.Transmission == nil || !c.Transmission.Adaptive || err != nil {
+		return
+	}
+
+	c.rtt.current(c.Transmission)
+	rto := c.rtt.sample(time.Since(start))
+	conn.Transmission().SetTransmissionAcknowledgeTimeout(c.Transmission.randomize(rto))
+}
@@ -0,0 +1,167 @@
+package gocoap
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Default ports of the coap and coaps schemes
+const (
+	DefaultPort       = 5683
+	DefaultSecurePort = 5684
+)
+
+// CoapURL is a parsed coap:// or coaps:// URL (RFC 7252 section 6). Host is an IP address or name without
+// brackets, IPv6 zones are kept as in fe80::1%eth0. Path and Query keep their percent-encoding, each
+// segment is decoded when the request is sent
+type CoapURL struct {
+	Scheme string
+	Host   string
+	Port   int
+	Path   string
+	Query  []string
+}
+
+// ParseURL parses a coap or coaps URL. The port defaults to 5683 for coap and 5684 for coaps. IPv6
+// addresses are written in brackets, with the zone percent-encoded as in coap://[fe80::1%25eth0]/
+func ParseURL(raw string) (*CoapURL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, ErrorBadURL
+	}
+
+	result := &CoapURL{
+		Scheme: strings.ToLower(u.Scheme),
+		Host:   u.Hostname(),
+		Path:   u.EscapedPath(),
+	}
+
+	switch result.Scheme {
+	case "coap":
+		result.Port = DefaultPort
+	case "coaps":
+		result.Port = DefaultSecurePort
+	default:
+		return nil, ErrorBadURL
+	}
+
+	if result.Host == "" || u.Fragment != "" || u.User != nil {
+		return nil, ErrorBadURL
+	}
+
+	if port := u.Port(); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, ErrorBadURL
+		}
+		result.Port = p
+	}
+
+	if result.Path == "" {
+		result.Path = "/"
+	}
+
+	if u.RawQuery != "" {
+		result.Query = strings.Split(u.RawQuery, "&")
+	}
+
+	for _, segment := range append(strings.Split(result.Path, "/"), result.Query...) {
+		if _, err := url.PathUnescape(segment); err != nil {
+			return nil, ErrorBadURL
+		}
+	}
+
+	return result, nil
+}
+
+// Secure reports whether the URL uses DTLS
+func (u *CoapURL) Secure() bool {
+	return u.Scheme == "coaps"
+}
+
+// Addr returns the host and port in host:port form, with brackets for IPv6
+func (u *CoapURL) Addr() string {
+	return net.JoinHostPort(u.Host, strconv.Itoa(u.Port))
+}
+
+// Uri returns the decoded path
+func (u *CoapURL) Uri() string {
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = unescape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (u *CoapURL) String() string {
+	result := u.Scheme + "://" + u.Addr()
+	if u.Scheme == "coap" && u.Port == DefaultPort || u.Scheme == "coaps" && u.Port == DefaultSecurePort {
+		result = u.Scheme + "://" + u.host()
+	}
+
+	result += u.Path
+	if len(u.Query) > 0 {
+		result += "?" + strings.Join(u.Query, "&")
+	}
+	return result
+}
+
+// host returns Host in URL form, with brackets and encoded zone for IPv6
+func (u *CoapURL) host() string {
+	if strings.Contains(u.Host, ":") {
+		return "[" + strings.Replace(u.Host, "%", "%25", 1) + "]"
+	}
+	return u.Host
+}
+
+// Request returns a request with method for the path and query of the URL
+func (u *CoapURL) Request(method RequestMethod) *Request {
+	req := NewRequest(method, u.Path)
+	req.Query = append([]string{}, u.Query...)
+	return req
+}
+
+// RequestParams returns the parameters of the package request functions for the URL. Uri is the
+// percent-encoded path and query, the request functions decode each segment. ident and key are
+// ignored for coap URLs, the requests are then sent over plain UDP
+func (u *CoapURL) RequestParams(ident, key string) (RequestParams, error) {
+	uri := u.Path
+	if len(u.Query) > 0 {
+		uri += "?" + strings.Join(u.Query, "&")
+	}
+	params := RequestParams{
+		Host: u.Host,
+		Port: u.Port,
+		Uri:  uri,
+	}
+	if u.Secure() {
+		params.Id = ident
+		params.Key = key
+	}
+	return params, nil
+}
+
+// Connection returns a CoapDTLSConnection to the host of a coaps URL. coap URLs return ErrorBadURL,
+// CoapDTLSConnection always uses DTLS, use RequestParams for plain UDP requests
+func (u *CoapURL) Connection(ident, key string) (*CoapDTLSConnection, error) {
+	if !u.Secure() {
+		return nil, ErrorBadURL
+	}
+
+	return &CoapDTLSConnection{
+		Host:  u.Host,
+		Port:  u.Port,
+		Ident: ident,
+		Key:   key,
+	}, nil
+}
+
+// unescape decodes a percent-encoded path segment or query, malformed escapes are left as they are
+func unescape(s string) string {
+	if decoded, err := url.PathUnescape(s); err == nil {
+		return decoded
+	}
+	return s
+}
@@ -0,0 +1,84 @@
+package gocoap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLRequestParams(t *testing.T) {
+	// Plain UDP, coap URLs are sent without DTLS
+	s := &CoapServer{Host: "127.0.0.1", Port: testPort(t)}
+	s.Handle("/15001/65536", GET, func(req ServerRequest) ([]byte, error) {
+		return []byte(fmt.Sprintf(`{"query":%q}`, strings.Join(req.Query, "&"))), nil
+	})
+	s.Handle("/15001/65536", PUT, func(req ServerRequest) ([]byte, error) {
+		return req.Payload, nil
+	})
+	go s.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+	defer s.Shutdown(context.Background())
+
+	tests := []struct {
+		name    string
+		url     string
+		request func(RequestParams) ([]byte, error)
+		payload string
+		want    string
+		err     error
+	}{
+		{
+			name:    "get",
+			url:     "/15001/65536",
+			request: GetRequest,
+			want:    `{"query":""}`,
+		},
+		{
+			name:    "get query",
+			url:     "/15001/65536?a=1&b",
+			request: GetRequest,
+			want:    `{"query":"a=1&b"}`,
+		},
+		{
+			name:    "put",
+			url:     "/15001/65536",
+			request: PutRequest,
+			payload: `{"3311":[{"5850":1}]}`,
+			want:    `{"3311":[{"5850":1}]}`,
+		},
+		{
+			name:    "not found",
+			url:     "/15001/65537",
+			request: GetRequest,
+			err:     UriNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := ParseURL(fmt.Sprintf("coap://%s:%d%s", s.Host, s.Port, tt.url))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			params, err := u.RequestParams("ignored", "ignored")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if params.Id != "" || params.Key != "" {
+				t.Fatalf("got Id %q Key %q for a coap URL, want none", params.Id, params.Key)
+			}
+			params.Payload = tt.payload
+
+			got, err := tt.request(params)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && string(got) != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}